@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the Alertmanager push
+const (
+	defaultAlertResendInterval = time.Minute
+	alertResolvedRetention     = 15 * time.Minute // time resolved alerts are re-sent, as in Prometheus
+	alertName                  = "DNSRBLListed"
+)
+
+// alertLabelName matches valid Prometheus label names
+var alertLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// alertReservedLabels are set by the exporter and cannot be configured
+var alertReservedLabels = map[string]bool{"alertname": true, "list": true, "ip": true, "domain": true, "sublist": true, "module": true}
+
+// Alertmanager receives the current listings as alerts, pushed to its
+// /api/v2/alerts endpoint like Prometheus does
+type Alertmanager struct {
+	URLs           []string
+	Headers        map[string]string
+	Labels         map[string]string // Labels added to all alerts
+	ResendInterval time.Duration     // Interval of re-sending firing alerts, which expire after 4 intervals
+	Timeout        time.Duration
+}
+
+// configAlertmanager is the Alertmanager push of the configuration file
+type configAlertmanager struct {
+	URLs           []string          `yaml:"urls"`
+	Headers        map[string]string `yaml:"headers"`
+	Labels         map[string]string `yaml:"labels"`
+	ResendInterval string            `yaml:"resend_interval"`
+	Timeout        string            `yaml:"timeout"`
+}
+
+// toAlertmanager validates the Alertmanager push of the configuration file.
+// ${VAR} references in the URLs and headers are expanded from the environment.
+func (c configAlertmanager) toAlertmanager() (Alertmanager, error) {
+	alertmanager := Alertmanager{
+		Labels:         c.Labels,
+		ResendInterval: defaultAlertResendInterval,
+		Timeout:        defaultWebhookTimeout,
+	}
+	for _, value := range c.URLs {
+		alertmanager.URLs = append(alertmanager.URLs, os.ExpandEnv(value))
+	}
+	if len(c.Headers) > 0 {
+		alertmanager.Headers = make(map[string]string, len(c.Headers))
+		for name, value := range c.Headers {
+			alertmanager.Headers[name] = os.ExpandEnv(value)
+		}
+	}
+	for _, setting := range []struct {
+		key   string
+		value string
+		dest  *time.Duration
+	}{
+		{"resend_interval", c.ResendInterval, &alertmanager.ResendInterval},
+		{"timeout", c.Timeout, &alertmanager.Timeout},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		duration, err := parseDuration(setting.value)
+		if err != nil || duration <= 0 {
+			return Alertmanager{}, fmt.Errorf("invalid %s %q", setting.key, setting.value)
+		}
+		*setting.dest = duration
+	}
+
+	return alertmanager, alertmanager.validate()
+}
+
+// validate checks the URLs and labels of an Alertmanager push
+func (a Alertmanager) validate() error {
+	if len(a.URLs) == 0 {
+		return errors.New("no URLs")
+	}
+	for _, value := range a.URLs {
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid Alertmanager URL %q: must be an http or https URL", value)
+		}
+	}
+	for name := range a.Labels {
+		if !alertLabelName.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if alertReservedLabels[name] {
+			return fmt.Errorf("label %q is set by the exporter", name)
+		}
+	}
+	return nil
+}
+
+// alert is an alert as accepted by the Alertmanager API v2
+type alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// alertPusher pushes an alert for each listed target and sub-list to the
+// configured Alertmanagers. Firing alerts are re-sent periodically, as
+// Alertmanager resolves alerts that are not renewed.
+type alertPusher struct {
+	mu           sync.Mutex
+	alertmanager *Alertmanager
+	lists        map[string]List
+	retries      int
+	backoff      time.Duration
+	firing       map[string]alert       // alerts of the last push by list, target and sub-list
+	listings     map[string]CheckStatus // latest listed result of the current listings, kept while later checks fail
+	resolved     map[string]alert       // alerts resolved within the retention, re-sent with their end
+	results      *resultStore
+	events       *eventLog
+	client       *http.Client
+	triggers     chan struct{}
+}
+
+func newAlertPusher(results *resultStore, events *eventLog) *alertPusher {
+	return &alertPusher{
+		firing:   make(map[string]alert),
+		resolved: make(map[string]alert),
+		listings: make(map[string]CheckStatus),
+		results:  results,
+		events:   events,
+		client:   &http.Client{},
+		triggers: make(chan struct{}, 1),
+	}
+}
+
+var listingAlerts = newAlertPusher(checkResults, listingEvents)
+
+// update replaces the Alertmanager configuration and the lists, and pushes
+// the alerts with it
+func (p *alertPusher) update(config *Config) {
+	lists := make(map[string]List, len(config.Lists))
+	for _, list := range config.Lists {
+		lists[list.Zone] = list
+	}
+
+	p.mu.Lock()
+	p.alertmanager = config.Notifications.Alertmanager
+	p.lists = lists
+	p.retries, p.backoff = config.Notifications.Retries, config.Notifications.Backoff
+	if p.alertmanager == nil {
+		p.firing = make(map[string]alert)
+		p.resolved = make(map[string]alert)
+		p.listings = make(map[string]CheckStatus)
+	}
+	p.mu.Unlock()
+
+	p.trigger()
+}
+
+// trigger pushes the alerts without waiting for the resend interval, e.g.
+// after a listing event
+func (p *alertPusher) trigger() {
+	select {
+	case p.triggers <- struct{}{}:
+	default:
+	}
+}
+
+// run pushes the alerts every resend interval and when triggered
+func (p *alertPusher) run() {
+	for {
+		p.mu.Lock()
+		interval := defaultAlertResendInterval
+		if p.alertmanager != nil {
+			interval = p.alertmanager.ResendInterval
+		}
+		p.mu.Unlock()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-p.triggers:
+			timer.Stop()
+		}
+		p.push(time.Now())
+	}
+}
+
+// push sends the alerts of all listed targets and of listings resolved since
+// the retention to all Alertmanagers
+func (p *alertPusher) push(now time.Time) {
+	p.mu.Lock()
+	if p.alertmanager == nil {
+		p.mu.Unlock()
+		return
+	}
+	alertmanager := *p.alertmanager
+	retries, backoff := p.retries, p.backoff
+
+	firing := p.alerts(alertmanager, now)
+	for key, previous := range p.firing {
+		if _, ok := firing[key]; !ok {
+			previous.EndsAt = now
+			p.resolved[key] = previous
+		}
+	}
+	for key, resolved := range p.resolved {
+		if _, ok := firing[key]; ok || now.Sub(resolved.EndsAt) > alertResolvedRetention {
+			delete(p.resolved, key)
+		}
+	}
+	p.firing = firing
+
+	alerts := make([]alert, 0, len(firing)+len(p.resolved))
+	for _, a := range firing {
+		alerts = append(alerts, a)
+	}
+	for _, a := range p.resolved {
+		alerts = append(alerts, a)
+	}
+	p.mu.Unlock()
+
+	if len(alerts) == 0 {
+		return
+	}
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		log.Printf("Failed to encode alerts: %v", err)
+		return
+	}
+
+	for _, value := range alertmanager.URLs {
+		// The webhook is only used for its headers, timeout and name
+		receiver := Webhook{URL: value, Headers: alertmanager.Headers, Timeout: alertmanager.Timeout}
+		endpoint := strings.TrimSuffix(value, "/") + "/api/v2/alerts"
+		err := withRetries(receiver.name(), retries, backoff, func() (bool, error) {
+			return sendRequest(p.client, receiver, http.MethodPost, endpoint, body)
+		})
+		if err != nil {
+			log.Printf("Failed to push %d alerts to %s: %v", len(alerts), receiver.name(), err)
+			dnsrblNotifications.WithLabelValues("alertmanager", "failed").Inc()
+			continue
+		}
+		dnsrblNotifications.WithLabelValues("alertmanager", "sent").Inc()
+	}
+}
+
+// alerts returns an alert for each listed target and sub-list of a configured
+// list, ending after four resend intervals unless renewed. Listings are those
+// of the event log, so alerts only resolve on delisting. While checks of a
+// listed target fail, the alerts of its last listed result are kept. The lock
+// must be held.
+func (p *alertPusher) alerts(alertmanager Alertmanager, now time.Time) map[string]alert {
+	alerts := make(map[string]alert)
+	listings := make(map[string]CheckStatus)
+	for _, status := range p.results.all() {
+		list, ok := p.lists[status.List]
+		if !ok {
+			continue
+		}
+		startsAt, listed := p.events.listedSince(status.List, status.Target)
+		if !listed {
+			continue
+		}
+		key := reasonKey(status.List, status.Target)
+		if !status.Listed {
+			last, ok := p.listings[key]
+			if !ok {
+				last, ok = p.listedEvent(status)
+			}
+			if !ok {
+				continue
+			}
+			status = last
+		}
+		listings[key] = status
+
+		labels := make(map[string]string, len(alertmanager.Labels)+5)
+		for name, value := range alertmanager.Labels {
+			labels[name] = value
+		}
+		labels["alertname"] = alertName
+		labels["list"] = status.List
+		if _, err := netip.ParseAddr(status.Target); err == nil {
+			labels["ip"] = status.Target
+		} else {
+			labels["domain"] = status.Target
+		}
+		if status.Module != "" {
+			labels["module"] = status.Module
+		}
+
+		notification := newNotification(ListingEvent{Type: eventListed, List: status.List, Target: status.Target}, list)
+		annotations := map[string]string{"summary": notification.headline()}
+		if status.Reason != "" {
+			annotations["reason"] = status.Reason
+		}
+		if list.DelistURL != "" {
+			annotations["delist_url"] = list.DelistURL
+		}
+
+		sublists := status.Sublists
+		if len(sublists) == 0 {
+			sublists = []string{""}
+		}
+		for _, sublist := range sublists {
+			a := alert{
+				Labels:      labels,
+				Annotations: annotations,
+				StartsAt:    startsAt,
+				EndsAt:      now.Add(4 * alertmanager.ResendInterval),
+			}
+			if sublist != "" {
+				a.Labels = make(map[string]string, len(labels)+1)
+				for name, value := range labels {
+					a.Labels[name] = value
+				}
+				a.Labels["sublist"] = sublist
+			}
+			alerts[key+"|"+sublist] = a
+		}
+	}
+	p.listings = listings
+	return alerts
+}
+
+// listedEvent returns the listed result of the latest listing event of a
+// target, e.g. when checks fail after a restart
+func (p *alertPusher) listedEvent(status CheckStatus) (CheckStatus, bool) {
+	events := p.events.filter(func(event ListingEvent) bool {
+		return event.Type == eventListed && event.List == status.List && event.Target == status.Target
+	})
+	if len(events) == 0 {
+		return CheckStatus{}, false
+	}
+	status.Listed = true
+	status.Sublists = events[0].Sublists
+	status.Reason = events[0].Reason
+	return status, true
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// checkAlert records a check result like the scheduler does
+func checkAlert(results *resultStore, events *eventLog, job checkJob, result checkResult, checked time.Time) {
+	results.set(job, result, checked)
+	events.observe(job, result, checked)
+}
+
+// pushedAlerts decodes the alerts of each push received by a test receiver
+func pushedAlerts(t *testing.T, receiver *testReceiver) [][]alert {
+	t.Helper()
+	var pushes [][]alert
+	for _, body := range receiver.received() {
+		var alerts []alert
+		if err := json.Unmarshal([]byte(body), &alerts); err != nil {
+			t.Fatalf("invalid alerts %s: %v", body, err)
+		}
+		pushes = append(pushes, alerts)
+	}
+	return pushes
+}
+
+func TestAlertPusher(t *testing.T) {
+	dnsrblNotifications.Reset()
+	defer dnsrblNotifications.Reset()
+	defer resetEventMetrics()
+
+	receiver, url := newTestReceiver(t)
+	results := newResultStore()
+	events := newEventLog(maxEvents)
+	pusher := newAlertPusher(results, events)
+	pusher.update(&Config{
+		Lists: []List{testList},
+		Notifications: Notifications{Alertmanager: &Alertmanager{
+			URLs:           []string{strings.TrimSuffix(url, "/hooks/secret")},
+			Labels:         map[string]string{"site": "edge-1"},
+			ResendInterval: time.Minute,
+			Timeout:        time.Second,
+		}},
+	})
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ip := checkJob{Target: Target{IP: "192.0.2.1", Module: "mail"}, List: testList}
+	domain := checkJob{Target: Target{Domain: "example.com"}, List: testList}
+	unknown := checkJob{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "bl.spamcop.net"}}
+
+	// Nothing is pushed without alerts
+	checkAlert(results, events, domain, checkResult{Result: "NXDOMAIN"}, start)
+	pusher.push(start)
+	if got := len(receiver.received()); got != 0 {
+		t.Fatalf("received %d pushes without listings; want 0", got)
+	}
+
+	listed := checkResult{Result: "Found", Sublists: []string{"sbl", "xbl"}, Reason: "Listed in SBL"}
+	checkAlert(results, events, ip, listed, start)
+	results.set(ip, listed, start.Add(time.Hour))
+	checkAlert(results, events, unknown, checkResult{Result: "Found", Sublists: []string{"spamcop"}}, start) // not configured
+
+	now := start.Add(time.Hour)
+	pusher.push(now)
+	pushes := pushedAlerts(t, receiver)
+	if len(pushes) != 1 || len(pushes[0]) != 2 {
+		t.Fatalf("pushes = %+v; want 2 alerts", pushes)
+	}
+	if got := receiver.requests[0].URL.Path; got != "/api/v2/alerts" {
+		t.Errorf("path = %s; want /api/v2/alerts", got)
+	}
+
+	sublists := make(map[string]bool)
+	for _, a := range pushes[0] {
+		sublists[a.Labels["sublist"]] = true
+		if a.Labels["alertname"] != alertName || a.Labels["list"] != "zen.spamhaus.org" || a.Labels["ip"] != "192.0.2.1" ||
+			a.Labels["module"] != "mail" || a.Labels["site"] != "edge-1" {
+			t.Errorf("labels = %v", a.Labels)
+		}
+		if a.Annotations["summary"] != "192.0.2.1 is listed in Spamhaus ZEN" || a.Annotations["reason"] != "Listed in SBL" ||
+			a.Annotations["delist_url"] != "https://check.spamhaus.org/" {
+			t.Errorf("annotations = %v", a.Annotations)
+		}
+		// Starts with the listing, not the latest check
+		if !a.StartsAt.Equal(start) || !a.EndsAt.Equal(now.Add(4*time.Minute)) {
+			t.Errorf("startsAt = %v, endsAt = %v", a.StartsAt, a.EndsAt)
+		}
+	}
+	if !sublists["sbl"] || !sublists["xbl"] {
+		t.Errorf("sublists = %v; want sbl and xbl", sublists)
+	}
+
+	// A listed domain is labelled as domain, a dropped sub-list is resolved
+	checkAlert(results, events, domain, checkResult{Result: "Found", Sublists: []string{"dbl"}}, now)
+	checkAlert(results, events, ip, checkResult{Result: "Found", Sublists: []string{"sbl"}}, now)
+	now = now.Add(time.Minute)
+	pusher.push(now)
+	alerts := make(map[string]alert)
+	for _, a := range pushedAlerts(t, receiver)[1] {
+		alerts[a.Labels["ip"]+a.Labels["domain"]+"|"+a.Labels["sublist"]] = a
+	}
+	if len(alerts) != 3 {
+		t.Fatalf("alerts = %+v; want 3", alerts)
+	}
+	if a := alerts["example.com|dbl"]; a.Labels["ip"] != "" || a.EndsAt.Before(now) {
+		t.Errorf("domain alert = %+v", a)
+	}
+	if a := alerts["192.0.2.1|xbl"]; !a.EndsAt.Equal(now) {
+		t.Errorf("xbl alert ends at %v; want %v", a.EndsAt, now)
+	}
+
+	// Failed checks keep the alerts of the last listed result firing
+	checkAlert(results, events, ip, checkResult{Result: "Timeout"}, now)
+	checkAlert(results, events, domain, checkResult{Result: "Refused"}, now)
+	now = now.Add(time.Minute)
+	pusher.push(now)
+	firing := pushedAlerts(t, receiver)[2]
+	if len(firing) != 3 {
+		t.Fatalf("alerts after failed checks = %+v; want 3", firing)
+	}
+	for _, a := range firing {
+		if a.Labels["sublist"] == "xbl" {
+			continue // resolved before
+		}
+		if !a.EndsAt.Equal(now.Add(4 * time.Minute)) {
+			t.Errorf("alert %v ends at %v after a failed check; want it firing", a.Labels, a.EndsAt)
+		}
+	}
+
+	// Delisting resolves the alerts, which are re-sent until the retention ends
+	checkAlert(results, events, ip, checkResult{Result: "NXDOMAIN"}, now)
+	checkAlert(results, events, domain, checkResult{Result: "NXDOMAIN"}, now)
+	pusher.push(now.Add(time.Minute))
+	resolved := pushedAlerts(t, receiver)[3]
+	if len(resolved) != 3 {
+		t.Fatalf("resolved = %+v; want 3 alerts", resolved)
+	}
+	for _, a := range resolved {
+		if a.EndsAt.After(now.Add(time.Minute)) {
+			t.Errorf("alert %v is not resolved", a.Labels)
+		}
+	}
+
+	pusher.push(now.Add(alertResolvedRetention + 2*time.Minute))
+	if got := len(receiver.received()); got != 4 {
+		t.Errorf("received %d pushes after the retention; want 4", got)
+	}
+	if got := testutil.ToFloat64(dnsrblNotifications.WithLabelValues("alertmanager", "sent")); got != 4 {
+		t.Errorf("dnsrbl_notifications_total{notifier=alertmanager,result=sent} = %v; want 4", got)
+	}
+}
+
+func TestAlertPusherFailedAfterRestart(t *testing.T) {
+	defer resetEventMetrics()
+
+	receiver, url := newTestReceiver(t)
+	job := checkJob{Target: Target{IP: "192.0.2.1"}, List: testList}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	events := newEventLog(maxEvents)
+	events.observe(job, checkResult{Result: "Found", Sublists: []string{"sbl"}, Reason: "Listed in SBL"}, start)
+
+	// The first check after a restart fails, the alert comes from the listing event
+	results := newResultStore()
+	results.set(job, checkResult{Result: "Timeout"}, start.Add(time.Hour))
+	pusher := newAlertPusher(results, events)
+	pusher.update(&Config{
+		Lists:         []List{testList},
+		Notifications: Notifications{Alertmanager: &Alertmanager{URLs: []string{url}, ResendInterval: time.Minute, Timeout: time.Second}},
+	})
+	pusher.push(start.Add(time.Hour))
+
+	pushes := pushedAlerts(t, receiver)
+	if len(pushes) != 1 || len(pushes[0]) != 1 {
+		t.Fatalf("pushes = %+v; want 1 alert", pushes)
+	}
+	if a := pushes[0][0]; a.Labels["sublist"] != "sbl" || a.Annotations["reason"] != "Listed in SBL" || !a.StartsAt.Equal(start) {
+		t.Errorf("alert = %+v", a)
+	}
+}
+
+func TestAlertPusherFailure(t *testing.T) {
+	dnsrblNotifications.Reset()
+	defer dnsrblNotifications.Reset()
+
+	receiver, url := newTestReceiver(t, 503, 400)
+	defer resetEventMetrics()
+
+	results := newResultStore()
+	events := newEventLog(maxEvents)
+	pusher := newAlertPusher(results, events)
+	pusher.update(&Config{
+		Lists: []List{testList},
+		Notifications: Notifications{
+			Alertmanager: &Alertmanager{URLs: []string{url}, ResendInterval: time.Minute, Timeout: time.Second},
+			Retries:      3,
+			Backoff:      time.Millisecond,
+		},
+	})
+
+	job := checkJob{Target: Target{IP: "192.0.2.1"}, List: testList}
+	checkAlert(results, events, job, checkResult{Result: "Found", Sublists: []string{"sbl"}}, time.Now())
+	pusher.push(time.Now())
+
+	if got := len(receiver.received()); got != 2 {
+		t.Errorf("received %d requests; want 2", got)
+	}
+	if got := testutil.ToFloat64(dnsrblNotifications.WithLabelValues("alertmanager", "failed")); got != 1 {
+		t.Errorf("dnsrbl_notifications_total{notifier=alertmanager,result=failed} = %v; want 1", got)
+	}
+
+	// Disabling the push stops it
+	pusher.update(&Config{Lists: []List{testList}})
+	pusher.push(time.Now())
+	if got := len(receiver.received()); got != 2 {
+		t.Errorf("received %d requests after disabling; want 2", got)
+	}
+}
+
+func TestConfigAlertmanager(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  configAlertmanager
+		wantErr string
+	}{
+		{"valid", configAlertmanager{URLs: []string{"http://alertmanager:9093"}, Labels: map[string]string{"severity": "warning"}, ResendInterval: "30s"}, ""},
+		{"no URLs", configAlertmanager{}, "no URLs"},
+		{"invalid URL", configAlertmanager{URLs: []string{"alertmanager:9093"}}, "invalid Alertmanager URL"},
+		{"invalid label name", configAlertmanager{URLs: []string{"http://alertmanager:9093"}, Labels: map[string]string{"team-name": "mail"}}, "invalid label name"},
+		{"reserved label", configAlertmanager{URLs: []string{"http://alertmanager:9093"}, Labels: map[string]string{"list": "x"}}, "set by the exporter"},
+		{"invalid resend interval", configAlertmanager{URLs: []string{"http://alertmanager:9093"}, ResendInterval: "0s"}, "invalid resend_interval"},
+		{"invalid timeout", configAlertmanager{URLs: []string{"http://alertmanager:9093"}, Timeout: "soon"}, "invalid timeout"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alertmanager, err := test.config.toAlertmanager()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("toAlertmanager() error = %v", err)
+				}
+				if alertmanager.ResendInterval != 30*time.Second || alertmanager.Timeout != defaultWebhookTimeout {
+					t.Errorf("alertmanager = %+v", alertmanager)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("toAlertmanager() error = %v; want %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nameserverCacheTTL is how long the nameservers of a zone are cached
+const nameserverCacheTTL = time.Hour
+
+// authoritativeResolver sends queries of a zone straight to the authoritative
+// nameservers of the zone, bypassing recursive resolvers. The nameservers are
+// looked up through the recursive resolver and cached.
+type authoritativeResolver struct {
+	zone      string
+	recursive *dnsResolver
+	port      string
+	ttl       time.Duration
+
+	mu       sync.Mutex
+	resolver *dnsResolver
+	expires  time.Time
+}
+
+func newAuthoritativeResolver(zone string, recursive *dnsResolver) *authoritativeResolver {
+	return &authoritativeResolver{
+		zone:      zone,
+		recursive: recursive,
+		port:      "53",
+		ttl:       nameserverCacheTTL,
+	}
+}
+
+// nameservers returns a resolver rotating across the cached authoritative
+// nameservers, refreshing them when the cache has expired
+func (a *authoritativeResolver) nameservers(ctx context.Context) (*dnsResolver, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.resolver != nil && time.Now().Before(a.expires) {
+		return a.resolver, nil
+	}
+
+	addresses, err := a.lookupNameservers(ctx)
+	if err != nil {
+		// Keep using expired nameservers rather than failing all queries
+		if a.resolver != nil {
+			log.Printf("Failed to refresh nameservers of %s, using cached ones: %v", a.zone, err)
+			return a.resolver, nil
+		}
+		return nil, err
+	}
+
+	log.Printf("Using authoritative nameservers %s for %s", strings.Join(addresses, ", "), a.zone)
+	resolver, err := newResolver(addresses)
+	if err != nil {
+		return nil, err
+	}
+	a.resolver = resolver
+	a.expires = time.Now().Add(a.ttl)
+	return a.resolver, nil
+}
+
+// lookupNameservers finds the addresses of the nameservers of the zone. Lists
+// without NS records of their own are served by the nameservers of a parent zone.
+// All names are fully qualified, so no search domains are sent to the nameservers.
+func (a *authoritativeResolver) lookupNameservers(ctx context.Context) ([]string, error) {
+	for zone := a.zone; strings.Contains(zone, "."); _, zone, _ = strings.Cut(zone, ".") {
+		records, err := a.recursive.resolver.LookupNS(ctx, fqdn(zone))
+		if err != nil || len(records) == 0 {
+			continue
+		}
+
+		var addresses []string
+		for _, record := range records {
+			ips, err := a.recursive.resolver.LookupIP(ctx, "ip4", fqdn(record.Host))
+			if err != nil {
+				log.Printf("Failed to resolve nameserver %s of %s: %v", record.Host, zone, err)
+				continue
+			}
+			for _, ip := range ips {
+				addresses = append(addresses, "udp://"+net.JoinHostPort(ip.String(), a.port))
+			}
+		}
+
+		if len(addresses) > 0 {
+			return addresses, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no authoritative nameservers found for %s", a.zone)
+}
+
+func (a *authoritativeResolver) lookupIP(ctx context.Context, query string) ([]net.IP, error) {
+	resolver, err := a.nameservers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.lookupIP(ctx, query)
+}
+
+func (a *authoritativeResolver) lookupTXT(ctx context.Context, query string) ([]string, error) {
+	resolver, err := a.nameservers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.lookupTXT(ctx, query)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAuthoritativeResolver(t *testing.T) {
+	authAddress, authQueries := startTestDNSServer(t, "udp", testDNSZone{
+		"2.0.0.127.bl.example.org":     {"127.0.0.2", "Listed"},
+		"2.0.0.127.sub.bl.example.org": {"127.0.0.3"},
+	})
+	_, authPort, _ := net.SplitHostPort(authAddress)
+
+	// The recursive resolver only knows the delegation of the zone
+	recursiveAddress, recursiveQueries := startTestDNSServer(t, "udp", testDNSZone{
+		"bl.example.org":     {"ns:ns1.bl.example.org"},
+		"ns1.bl.example.org": {"127.0.0.1"},
+	})
+	recursive, err := newResolver([]string{recursiveAddress})
+	if err != nil {
+		t.Fatalf("newResolver() unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("zone with nameservers", func(t *testing.T) {
+		resolver := newAuthoritativeResolver("bl.example.org", recursive)
+		resolver.port = authPort
+
+		ips, err := resolver.lookupIP(ctx, "2.0.0.127.bl.example.org.")
+		if err != nil {
+			t.Fatalf("lookupIP() unexpected error: %v", err)
+		}
+		if len(ips) != 1 || ips[0].String() != "127.0.0.2" {
+			t.Errorf("lookupIP() = %v; want [127.0.0.2]", ips)
+		}
+
+		txt, err := resolver.lookupTXT(ctx, "2.0.0.127.bl.example.org.")
+		if err != nil || len(txt) != 1 || txt[0] != "Listed" {
+			t.Errorf("lookupTXT() = %q, %v; want [Listed]", txt, err)
+		}
+
+		if authQueries.Load() < 2 {
+			t.Errorf("authoritative server received %d queries; want at least 2", authQueries.Load())
+		}
+	})
+
+	t.Run("nameservers are cached", func(t *testing.T) {
+		resolver := newAuthoritativeResolver("bl.example.org", recursive)
+		resolver.port = authPort
+
+		resolver.lookupIP(ctx, "2.0.0.127.bl.example.org.")
+		before := recursiveQueries.Load()
+		resolver.lookupIP(ctx, "2.0.0.127.bl.example.org.")
+		if after := recursiveQueries.Load(); after != before {
+			t.Errorf("recursive resolver received %d additional queries; want 0", after-before)
+		}
+	})
+
+	t.Run("zone without nameservers uses parent", func(t *testing.T) {
+		resolver := newAuthoritativeResolver("sub.bl.example.org", recursive)
+		resolver.port = authPort
+
+		ips, err := resolver.lookupIP(ctx, "2.0.0.127.sub.bl.example.org.")
+		if err != nil {
+			t.Fatalf("lookupIP() unexpected error: %v", err)
+		}
+		if len(ips) != 1 || ips[0].String() != "127.0.0.3" {
+			t.Errorf("lookupIP() = %v; want [127.0.0.3]", ips)
+		}
+	})
+
+	t.Run("unknown zone", func(t *testing.T) {
+		resolver := newAuthoritativeResolver("bl.unknown.example", recursive)
+		if _, err := resolver.lookupIP(ctx, "2.0.0.127.bl.unknown.example."); err == nil {
+			t.Error("lookupIP() expected error but got none")
+		}
+	})
+}
+
+func TestAuthoritativeResolver_SearchDomains(t *testing.T) {
+	authAddress, authQuestions := startRecordingDNSServer(t, testDNSZone{})
+	_, authPort, _ := net.SplitHostPort(authAddress)
+	recursiveAddress, recursiveQuestions := startRecordingDNSServer(t, testDNSZone{
+		"bl.example.org":     {"ns:ns1.bl.example.org"},
+		"ns1.bl.example.org": {"127.0.0.1"},
+	})
+	recursive, err := newResolver([]string{recursiveAddress})
+	if err != nil {
+		t.Fatalf("newResolver() unexpected error: %v", err)
+	}
+
+	// No names with search domains of resolv.conf reach the nameservers,
+	// which would refuse them
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resolver := newAuthoritativeResolver("sub.bl.example.org", recursive)
+	resolver.port = authPort
+	if _, err := resolver.lookupIP(ctx, "2.0.0.127.sub.bl.example.org."); err == nil {
+		t.Error("lookupIP() expected NXDOMAIN")
+	}
+
+	want := []string{"sub.bl.example.org.", "bl.example.org.", "ns1.bl.example.org."}
+	if got := recursiveQuestions(); !slices.Equal(got, want) {
+		t.Errorf("recursive questions = %v; want %v", got, want)
+	}
+	if got, want := authQuestions(), []string{"2.0.0.127.sub.bl.example.org."}; !slices.Equal(got, want) {
+		t.Errorf("authoritative questions = %v; want %v", got, want)
+	}
+}
+
+func TestResolverSet_Authoritative(t *testing.T) {
+	config := &Config{
+		ResolverMode: resolverModeRecursive,
+		Lists: []List{
+			{Zone: "bl.example.org", Type: listTypeIP, IPv4: true},
+			{Zone: "auth.example.org", Type: listTypeIP, IPv4: true, Authoritative: true},
+		},
+	}
+
+	set, err := newResolverSet(config)
+	if err != nil {
+		t.Fatalf("newResolverSet() unexpected error: %v", err)
+	}
+	if _, ok := set.forList(config.Lists[0]).(*dnsResolver); !ok {
+		t.Error("recursive list should use the default resolver")
+	}
+	if _, ok := set.forList(config.Lists[1]).(*authoritativeResolver); !ok {
+		t.Error("authoritative list should use an authoritative resolver")
+	}
+
+	config.ResolverMode = resolverModeAuthoritative
+	set, err = newResolverSet(config)
+	if err != nil {
+		t.Fatalf("newResolverSet() unexpected error: %v", err)
+	}
+	if _, ok := set.forList(config.Lists[0]).(*authoritativeResolver); !ok {
+		t.Error("authoritative mode should use authoritative resolvers for all lists")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// catalogueFile is a structured list catalogue in YAML or JSON format
+type catalogueFile struct {
+	Lists []catalogueList `yaml:"lists" json:"lists"`
+}
+
+// catalogueList is a list entry of a structured list catalogue
+type catalogueList struct {
+	Zone          string            `yaml:"zone" json:"zone"`
+	Name          string            `yaml:"name" json:"name"`
+	Homepage      string            `yaml:"homepage" json:"homepage"`
+	DelistURL     string            `yaml:"delist_url" json:"delist_url"`
+	Type          string            `yaml:"type" json:"type"`
+	IPv4          bool              `yaml:"ipv4" json:"ipv4"`
+	IPv6          bool              `yaml:"ipv6" json:"ipv6"`
+	Severity      *float64          `yaml:"severity" json:"severity"`
+	Interval      string            `yaml:"interval" json:"interval"`
+	Authoritative bool              `yaml:"authoritative" json:"authoritative"`
+	Resolvers     []string          `yaml:"resolvers" json:"resolvers"`
+	AccessKey     *string           `yaml:"access_key" json:"access_key"`
+	ReturnCodes   map[string]string `yaml:"return_codes" json:"return_codes"`
+	ReturnBitmask map[int]string    `yaml:"return_bitmask" json:"return_bitmask"`
+	RefusedCodes  []string          `yaml:"refused_codes" json:"refused_codes"`
+}
+
+// isCatalogueFile reports whether a lists file is a structured catalogue
+func isCatalogueFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// readCatalogue reads a structured list catalogue. Unknown fields are rejected.
+func readCatalogue(filename string) ([]List, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var catalogue catalogueFile
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&catalogue)
+	} else {
+		err = yaml.UnmarshalStrict(data, &catalogue)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+
+	lists := make([]List, 0, len(catalogue.Lists))
+	seen := make(map[string]bool)
+	for i, entry := range catalogue.Lists {
+		list, err := entry.toList()
+		if err != nil {
+			return nil, fmt.Errorf("%s: list %d: %w", filename, i+1, err)
+		}
+		if seen[list.Zone] {
+			return nil, fmt.Errorf("%s: list %d: duplicate zone %s", filename, i+1, list.Zone)
+		}
+		seen[list.Zone] = true
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
+// toList validates a catalogue entry and converts it into a list
+func (c catalogueList) toList() (List, error) {
+	list := List{
+		Zone:          strings.TrimSuffix(strings.ToLower(strings.TrimSpace(c.Zone)), "."),
+		Type:          c.Type,
+		IPv4:          c.IPv4,
+		IPv6:          c.IPv6,
+		Resolvers:     c.Resolvers,
+		Authoritative: c.Authoritative,
+		Name:          c.Name,
+		Homepage:      c.Homepage,
+		DelistURL:     c.DelistURL,
+		Severity:      1,
+		ReturnCodes: returnCodes{
+			Codes:   c.ReturnCodes,
+			Bitmask: c.ReturnBitmask,
+			Refused: c.RefusedCodes,
+		},
+	}
+
+	if list.Zone == "" || strings.ContainsAny(list.Zone, ": /") {
+		return List{}, fmt.Errorf("invalid zone %q", c.Zone)
+	}
+
+	switch list.Type {
+	case "":
+		list.Type = listTypeIP
+	case listTypeIP, listTypeDomain:
+	default:
+		return List{}, fmt.Errorf("%s: invalid type %q", list.Zone, c.Type)
+	}
+
+	if list.Type == listTypeDomain {
+		if list.IPv4 || list.IPv6 {
+			return List{}, fmt.Errorf("%s: domain lists do not support address families", list.Zone)
+		}
+	} else if !list.IPv4 && !list.IPv6 {
+		list.IPv4 = true
+	}
+
+	if c.Severity != nil {
+		if *c.Severity < 0 {
+			return List{}, fmt.Errorf("%s: invalid severity %v", list.Zone, *c.Severity)
+		}
+		list.Severity = *c.Severity
+	}
+
+	if c.Interval != "" {
+		interval, err := parseDuration(c.Interval)
+		if err != nil || interval <= 0 {
+			return List{}, fmt.Errorf("%s: invalid interval %q", list.Zone, c.Interval)
+		}
+		list.Interval = interval
+	}
+
+	for _, resolver := range list.Resolvers {
+		if _, err := parseResolver(resolver); err != nil {
+			return List{}, fmt.Errorf("%s: %w", list.Zone, err)
+		}
+	}
+
+	for answer := range c.ReturnCodes {
+		if net.ParseIP(answer).To4() == nil {
+			return List{}, fmt.Errorf("%s: invalid return code %q", list.Zone, answer)
+		}
+	}
+	for bit := range c.ReturnBitmask {
+		if bit <= 0 || bit > 255 || bit&(bit-1) != 0 {
+			return List{}, fmt.Errorf("%s: invalid return bitmask %d", list.Zone, bit)
+		}
+	}
+	for _, answer := range c.RefusedCodes {
+		if net.ParseIP(answer).To4() == nil {
+			return List{}, fmt.Errorf("%s: invalid refused code %q", list.Zone, answer)
+		}
+	}
+
+	if c.AccessKey != nil {
+		list.AccessKeyRequired = true
+		list.AccessKey = os.ExpandEnv(*c.AccessKey)
+	}
+
+	return list, nil
+}
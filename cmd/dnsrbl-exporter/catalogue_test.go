@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	return filename
+}
+
+func TestReadCatalogue_YAML(t *testing.T) {
+	os.Setenv("TEST_CATALOGUE_KEY", "secretkey")
+	defer os.Unsetenv("TEST_CATALOGUE_KEY")
+
+	filename := writeTestFile(t, "lists.yaml", `
+lists:
+  - zone: zen.spamhaus.org
+    name: Spamhaus ZEN
+    homepage: https://www.spamhaus.org/
+    delist_url: https://check.spamhaus.org/
+    ipv4: true
+    ipv6: true
+    severity: 10
+    interval: 15m
+  - zone: multi.surbl.org
+    type: domain
+    interval: 600
+    return_bitmask:
+      8: ph
+      16: mw
+    refused_codes: [127.0.0.1]
+  - zone: dnsbl.httpbl.org
+    access_key: ${TEST_CATALOGUE_KEY}
+    return_codes:
+      127.1.1.1: suspicious
+`)
+
+	lists, err := readCatalogue(filename)
+	if err != nil {
+		t.Fatalf("readCatalogue() unexpected error: %v", err)
+	}
+
+	expected := []List{
+		{
+			Zone:      "zen.spamhaus.org",
+			Type:      listTypeIP,
+			IPv4:      true,
+			IPv6:      true,
+			Name:      "Spamhaus ZEN",
+			Homepage:  "https://www.spamhaus.org/",
+			DelistURL: "https://check.spamhaus.org/",
+			Severity:  10,
+			Interval:  15 * time.Minute,
+		},
+		{
+			Zone:     "multi.surbl.org",
+			Type:     listTypeDomain,
+			Severity: 1,
+			Interval: 10 * time.Minute,
+			ReturnCodes: returnCodes{
+				Bitmask: map[int]string{8: "ph", 16: "mw"},
+				Refused: []string{"127.0.0.1"},
+			},
+		},
+		{
+			Zone:              "dnsbl.httpbl.org",
+			Type:              listTypeIP,
+			IPv4:              true,
+			Severity:          1,
+			AccessKey:         "secretkey",
+			AccessKeyRequired: true,
+			ReturnCodes: returnCodes{
+				Codes: map[string]string{"127.1.1.1": "suspicious"},
+			},
+		},
+	}
+
+	if len(lists) != len(expected) {
+		t.Fatalf("readCatalogue() returned %d lists; want %d", len(lists), len(expected))
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(lists[i], expected[i]) {
+			t.Errorf("readCatalogue()[%d] = %+v; want %+v", i, lists[i], expected[i])
+		}
+	}
+}
+
+func TestReadCatalogue_JSON(t *testing.T) {
+	filename := writeTestFile(t, "lists.json", `{
+  "lists": [
+    {"zone": "bl.spamcop.net", "name": "SpamCop", "severity": 0},
+    {"zone": "v6.example.org", "ipv6": true, "return_bitmask": {"2": "black"}}
+  ]
+}`)
+
+	lists, err := readCatalogue(filename)
+	if err != nil {
+		t.Fatalf("readCatalogue() unexpected error: %v", err)
+	}
+	if len(lists) != 2 {
+		t.Fatalf("readCatalogue() returned %d lists; want %d", len(lists), 2)
+	}
+	if lists[0].Name != "SpamCop" || lists[0].Severity != 0 || !lists[0].IPv4 {
+		t.Errorf("readCatalogue()[0] = %+v", lists[0])
+	}
+	if lists[1].IPv4 || !lists[1].IPv6 || lists[1].ReturnCodes.Bitmask[2] != "black" {
+		t.Errorf("readCatalogue()[1] = %+v", lists[1])
+	}
+}
+
+func TestReadCatalogue_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "unknown YAML field", file: "lists.yaml", content: "lists:\n  - zone: bl.example.org\n    colour: red\n"},
+		{name: "unknown JSON field", file: "lists.json", content: `{"lists": [{"zone": "bl.example.org", "colour": "red"}]}`},
+		{name: "missing zone", file: "lists.yaml", content: "lists:\n  - name: Example\n"},
+		{name: "duplicate zone", file: "lists.yaml", content: "lists:\n  - zone: bl.example.org\n  - zone: bl.example.org\n"},
+		{name: "invalid type", file: "lists.yaml", content: "lists:\n  - zone: bl.example.org\n    type: url\n"},
+		{name: "domain list with address family", file: "lists.yaml", content: "lists:\n  - zone: dbl.example.org\n    type: domain\n    ipv6: true\n"},
+		{name: "invalid interval", file: "lists.yaml", content: "lists:\n  - zone: bl.example.org\n    interval: daily\n"},
+		{name: "invalid resolver", file: "lists.yaml", content: "lists:\n  - zone: bl.example.org\n    resolvers: [quic://10.0.0.1]\n"},
+		{name: "invalid return code", file: "lists.yaml", content: "lists:\n  - zone: bl.example.org\n    return_codes:\n      listed: sbl\n"},
+		{name: "invalid bitmask", file: "lists.yaml", content: "lists:\n  - zone: bl.example.org\n    return_bitmask:\n      3: sbl\n"},
+		{name: "negative severity", file: "lists.yaml", content: "lists:\n  - zone: bl.example.org\n    severity: -1\n"},
+		{name: "malformed", file: "lists.json", content: `{"lists": [`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeTestFile(t, tt.file, tt.content)
+			if _, err := readCatalogue(filename); err == nil {
+				t.Errorf("readCatalogue() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestReadLists(t *testing.T) {
+	text := writeTestFile(t, "lists.txt", "# comment\nzen.spamhaus.org:ipv4,ipv6\nbl.spamcop.net\n")
+	lists, err := readLists(text)
+	if err != nil {
+		t.Fatalf("readLists(%q) unexpected error: %v", text, err)
+	}
+	if len(lists) != 2 || lists[0].Zone != "zen.spamhaus.org" || !lists[0].IPv6 {
+		t.Errorf("readLists(%q) = %+v", text, lists)
+	}
+
+	yml := writeTestFile(t, "lists.yml", "lists:\n  - zone: bl.spamcop.net\n")
+	lists, err = readLists(yml)
+	if err != nil {
+		t.Fatalf("readLists(%q) unexpected error: %v", yml, err)
+	}
+	if len(lists) != 1 || lists[0].Zone != "bl.spamcop.net" {
+		t.Errorf("readLists(%q) = %+v", yml, lists)
+	}
+}
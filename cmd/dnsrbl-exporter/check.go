@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// checkResult is the outcome of a check of a target against a list
+type checkResult struct {
+	Result   string // result type of errorMapping, empty if the check was skipped
+	Answers  []string
+	Sublists []string
+	Reason   string
+	Duration time.Duration
+}
+
+// queryList checks a target against a list without recording the result
+func queryList(ctx context.Context, resolver lookupResolver, target Target, list List) checkResult {
+	blacklist := list.Zone
+	name := target.Domain
+	if name == "" {
+		name = convertToReverseIP(target.IP)
+	}
+	query := fmt.Sprintf("%s.%s.", name, blacklist)
+
+	if list.AccessKeyRequired {
+		if list.AccessKey == "" {
+			log.Printf("Skipping blacklist %s due to missing access key", blacklist)
+			return checkResult{}
+		}
+		query = fmt.Sprintf("%s.%s.%s.", list.AccessKey, name, blacklist)
+	}
+
+	log.Printf("Checking %s.%s.", name, blacklist)
+
+	start := time.Now()
+	result := checkResult{Result: "Found"}
+	answers, err := resolver.lookupIP(ctx, query)
+	switch {
+	case err != nil:
+		result.Result = classifyDNSError(err)
+		log.Printf("Error: %s", result.Result)
+	case len(answers) == 0:
+		result.Result = "NoAnswer"
+		log.Printf("Error: NoAnswer")
+	default:
+		for _, answer := range answers {
+			result.Answers = append(result.Answers, answer.String())
+		}
+
+		if isRefused(list, result.Answers) {
+			result.Result = "Refused"
+			log.Printf("Error: Refused (%s)", strings.Join(result.Answers, ", "))
+			break
+		}
+
+		for _, answer := range result.Answers {
+			log.Printf("Match: %s found in %s", answer, blacklist)
+		}
+		result.Sublists = decodeAnswers(list, result.Answers)
+		log.Printf("Sub-lists: %s", strings.Join(result.Sublists, ", "))
+		result.Reason = lookupReason(ctx, resolver, query)
+	}
+	result.Duration = time.Since(start)
+
+	return result
+}
+
+// resultMetrics are the metrics the results of checks are recorded in.
+// The query counter and the httpbl metrics are optional.
+type resultMetrics struct {
+	targetLabel  string
+	query        *prometheus.CounterVec
+	status       *prometheus.GaugeVec
+	listed       *prometheus.GaugeVec
+	reason       *prometheus.GaugeVec
+	reasons      *reasonStore
+	lastActivity *prometheus.GaugeVec
+	threatScore  *prometheus.GaugeVec
+	visitorType  *prometheus.GaugeVec
+}
+
+var (
+	ipResultMetrics = resultMetrics{
+		targetLabel:  "ip",
+		query:        dnsrblQuery,
+		status:       dnsrblStatus,
+		listed:       dnsrblListed,
+		reason:       dnsrblListingReason,
+		reasons:      listingReasons,
+		lastActivity: httpblLastActivity,
+		threatScore:  httpblThreatScore,
+		visitorType:  httpblVisitorType,
+	}
+
+	domainResultMetrics = resultMetrics{
+		targetLabel: "domain",
+		query:       dnsrblDomainQuery,
+		status:      dnsrblDomainStatus,
+		listed:      dnsrblDomainListed,
+		reason:      dnsrblDomainListingReason,
+		reasons:     listingReasons,
+	}
+)
+
+// record records the result of a check of a target against a list
+func (m resultMetrics) record(blacklist, target string, result checkResult) {
+	switch result.Result {
+	case "Found":
+		if blacklist == "dnsbl.httpbl.org" && m.threatScore != nil {
+			m.recordHTTPBL(blacklist, target, result.Answers)
+		}
+		setListed(m.listed, m.targetLabel, blacklist, target, result.Sublists)
+		m.reasons.set(m.reason, m.targetLabel, blacklist, target, result.Reason)
+	case "NXDOMAIN":
+		setListed(m.listed, m.targetLabel, blacklist, target, nil)
+		m.reasons.set(m.reason, m.targetLabel, blacklist, target, "")
+	}
+
+	if m.query != nil {
+		m.query.WithLabelValues(blacklist, target, result.Result).Inc()
+	}
+	m.status.WithLabelValues(blacklist, target).Set(statusValue(result.Result))
+}
+
+// recordHTTPBL records the visitor details encoded in ProjectHoneyPot.org answers
+func (m resultMetrics) recordHTTPBL(blacklist, target string, answers []string) {
+	for _, answer := range answers {
+		parts := strings.Split(answer, ".")
+		if len(parts) < 4 {
+			continue
+		}
+
+		lastActivity, _ := strconv.ParseFloat(parts[1], 64)
+		threatScore, _ := strconv.ParseFloat(parts[2], 64)
+		visitorType, _ := strconv.ParseFloat(parts[3], 64)
+
+		m.lastActivity.WithLabelValues(blacklist, target).Set(lastActivity)
+		m.threatScore.WithLabelValues(blacklist, target).Set(threatScore)
+		m.visitorType.WithLabelValues(blacklist, target).Set(visitorType)
+
+		log.Printf("Last activity: %s days ago", parts[1])
+		log.Printf("Threat score: %s", parts[2])
+		log.Printf("Visitor type: %s", parts[3])
+	}
+}
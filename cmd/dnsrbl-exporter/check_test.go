@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQueryList(t *testing.T) {
+	zone := testDNSZone{
+		"2.0.0.127.bl.example.org":         {"127.0.0.2", "Listed, see https://bl.example.org/lookup"},
+		"3.0.0.127.zen.spamhaus.org":       {"127.255.255.254"},
+		"2.0.0.127.zen.spamhaus.org":       {"127.0.0.2", "127.0.0.10"},
+		"example.com.dbl.example.org":      {"127.0.1.2"},
+		"secret.2.0.0.127.key.example.org": {"127.0.0.2"},
+	}
+	address, _ := startTestDNSServer(t, "udp", zone)
+	resolver, err := newResolver([]string{address})
+	if err != nil {
+		t.Fatalf("newResolver() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		target   Target
+		list     List
+		result   string
+		sublists []string
+		reason   string
+	}{
+		{
+			name:     "listed",
+			target:   Target{IP: "127.0.0.2"},
+			list:     List{Zone: "bl.example.org"},
+			result:   "Found",
+			sublists: []string{"127.0.0.2"},
+			reason:   "Listed, see https://bl.example.org/lookup",
+		},
+		{
+			name:   "not listed",
+			target: Target{IP: "127.0.0.4"},
+			list:   List{Zone: "bl.example.org"},
+			result: "NXDOMAIN",
+		},
+		{
+			name:     "decoded",
+			target:   Target{IP: "127.0.0.2"},
+			list:     List{Zone: "zen.spamhaus.org"},
+			result:   "Found",
+			sublists: []string{"pbl", "sbl"},
+		},
+		{
+			name:   "refused",
+			target: Target{IP: "127.0.0.3"},
+			list:   List{Zone: "zen.spamhaus.org"},
+			result: "Refused",
+		},
+		{
+			name:     "domain",
+			target:   Target{Domain: "example.com"},
+			list:     List{Zone: "dbl.example.org", Type: listTypeDomain},
+			result:   "Found",
+			sublists: []string{"127.0.1.2"},
+		},
+		{
+			name:     "access key",
+			target:   Target{IP: "127.0.0.2"},
+			list:     List{Zone: "key.example.org", AccessKey: "secret", AccessKeyRequired: true},
+			result:   "Found",
+			sublists: []string{"127.0.0.2"},
+		},
+		{
+			name:   "missing access key",
+			target: Target{IP: "127.0.0.2"},
+			list:   List{Zone: "key.example.org", AccessKeyRequired: true},
+			result: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result := queryList(ctx, resolver, tt.target, tt.list)
+			if result.Result != tt.result {
+				t.Errorf("queryList() result = %q; want %q", result.Result, tt.result)
+			}
+			if strings.Join(result.Sublists, ",") != strings.Join(tt.sublists, ",") {
+				t.Errorf("queryList() sublists = %q; want %q", result.Sublists, tt.sublists)
+			}
+			if result.Reason != tt.reason {
+				t.Errorf("queryList() reason = %q; want %q", result.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestResultMetricsRecord(t *testing.T) {
+	metrics := resultMetrics{
+		targetLabel: "ip",
+		query:       prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_query"}, []string{"list", "ip", "result"}),
+		status:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_status"}, []string{"list", "ip"}),
+		listed:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_listed"}, []string{"list", "ip", "sublist"}),
+		reason:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_reason"}, []string{"list", "ip", "reason"}),
+		reasons:     newReasonStore(),
+	}
+
+	metrics.record("zen.spamhaus.org", "192.0.2.1", checkResult{
+		Result:   "Found",
+		Answers:  []string{"127.0.0.2", "127.0.0.10"},
+		Sublists: []string{"pbl", "sbl"},
+		Reason:   "Listed",
+	})
+	if got := testutil.ToFloat64(metrics.status.WithLabelValues("zen.spamhaus.org", "192.0.2.1")); got != 1 {
+		t.Errorf("status = %v; want 1", got)
+	}
+	if got := testutil.CollectAndCount(metrics.listed); got != 2 {
+		t.Errorf("listed series = %d; want 2", got)
+	}
+	if got := len(metrics.reasons.all()); got != 1 {
+		t.Errorf("reasons = %d; want 1", got)
+	}
+
+	// Timeouts keep the previous listing
+	metrics.record("zen.spamhaus.org", "192.0.2.1", checkResult{Result: "Timeout"})
+	if got := testutil.ToFloat64(metrics.status.WithLabelValues("zen.spamhaus.org", "192.0.2.1")); got != 4 {
+		t.Errorf("status = %v; want 4", got)
+	}
+	if got := testutil.CollectAndCount(metrics.listed); got != 2 {
+		t.Errorf("listed series = %d; want 2", got)
+	}
+
+	// A delisting clears the sub-lists and the reason
+	metrics.record("zen.spamhaus.org", "192.0.2.1", checkResult{Result: "NXDOMAIN"})
+	if got := testutil.ToFloat64(metrics.status.WithLabelValues("zen.spamhaus.org", "192.0.2.1")); got != 0 {
+		t.Errorf("status = %v; want 0", got)
+	}
+	if got := testutil.CollectAndCount(metrics.listed) + testutil.CollectAndCount(metrics.reason); got != 0 {
+		t.Errorf("listed and reason series = %d; want 0", got)
+	}
+	if got := testutil.CollectAndCount(metrics.query); got != 3 {
+		t.Errorf("query series = %d; want 3", got)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// configFile is the YAML configuration file given with --config
+type configFile struct {
+	ListenAddress   string                  `yaml:"listen_address"`
+	Targets         configTargets           `yaml:"targets"`
+	MaxCIDRSize     *int                    `yaml:"max_cidr_size"`
+	Lists           []catalogueList         `yaml:"lists"`
+	Modules         map[string]configModule `yaml:"modules"`
+	ListsFile       string                  `yaml:"lists_file"`
+	Resolvers       []string                `yaml:"resolvers"`
+	ResolverMode    string                  `yaml:"resolver_mode"`
+	Intervals       configIntervals         `yaml:"intervals"`
+	Concurrency     *int                    `yaml:"concurrency"`
+	Jitter          *int                    `yaml:"jitter"`
+	HTTPBLAccessKey string                  `yaml:"http_bl_access_key"`
+	StateFile       string                  `yaml:"state_file"`
+	Notifications   configNotifications     `yaml:"notifications"`
+}
+
+// configTargets are the targets of the configuration file
+type configTargets struct {
+	IPs         []string `yaml:"ips"`
+	IPsFile     string   `yaml:"ips_file"`
+	Domains     []string `yaml:"domains"`
+	DomainsFile string   `yaml:"domains_file"`
+}
+
+// configIntervals are the delays of the configuration file, e.g. "60s" or "15m"
+type configIntervals struct {
+	Runs         string `yaml:"runs"`
+	Requests     string `yaml:"requests"`
+	ListRequests string `yaml:"list_requests"`
+}
+
+// readConfigFile reads the configuration file. Unknown keys are rejected.
+func readConfigFile(filename string) (*configFile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var file configFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	return &file, nil
+}
+
+// apply sets the values of the configuration file on a configuration
+func (f *configFile) apply(config *Config) error {
+	if f.ListenAddress != "" {
+		config.ListenAddress = f.ListenAddress
+	}
+	if f.MaxCIDRSize != nil {
+		config.MaxCIDRSize = *f.MaxCIDRSize
+	}
+	if f.Concurrency != nil {
+		config.Concurrency = *f.Concurrency
+	}
+	if f.Jitter != nil {
+		config.Jitter = *f.Jitter
+	}
+	if f.ResolverMode != "" {
+		config.ResolverMode = f.ResolverMode
+	}
+	if f.Resolvers != nil {
+		config.Resolvers = f.Resolvers
+	}
+	if f.HTTPBLAccessKey != "" {
+		config.HTTPBLAccessKey = os.ExpandEnv(f.HTTPBLAccessKey)
+	}
+	if f.StateFile != "" {
+		config.StateFile = f.StateFile
+	}
+
+	if err := f.Notifications.apply(&config.Notifications); err != nil {
+		return err
+	}
+
+	for _, interval := range []struct {
+		key   string
+		value string
+		dest  *time.Duration
+	}{
+		{"intervals.runs", f.Intervals.Runs, &config.DelayBetweenRuns},
+		{"intervals.requests", f.Intervals.Requests, &config.DelayBetweenRequests},
+		{"intervals.list_requests", f.Intervals.ListRequests, &config.DelayBetweenListRequests},
+	} {
+		if interval.value == "" {
+			continue
+		}
+		duration, err := parseDuration(interval.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", interval.key, interval.value)
+		}
+		*interval.dest = duration
+	}
+
+	ips, err := fileEntries(config, f.Targets.IPs, f.Targets.IPsFile)
+	if err != nil {
+		return fmt.Errorf("failed to read check IP file: %w", err)
+	}
+	config.CheckIPs = ips
+	domains, err := fileEntries(config, f.Targets.Domains, f.Targets.DomainsFile)
+	if err != nil {
+		return fmt.Errorf("failed to read check domain file: %w", err)
+	}
+	config.CheckDomains = domains
+
+	for i, entry := range f.Lists {
+		list, err := entry.toList()
+		if err != nil {
+			return fmt.Errorf("list %d: %w", i+1, err)
+		}
+		config.Lists = append(config.Lists, list)
+	}
+	if f.ListsFile != "" {
+		config.Files = append(config.Files, f.ListsFile)
+		lists, err := readLists(f.ListsFile)
+		if err != nil {
+			return fmt.Errorf("failed to read lists: %w", err)
+		}
+		config.Lists = append(config.Lists, lists...)
+	}
+
+	return nil
+}
+
+// fileEntries combines the inline entries of the configuration file with
+// the entries of a referenced file
+func fileEntries(config *Config, entries []string, filename string) ([]string, error) {
+	if filename == "" {
+		return entries, nil
+	}
+	config.Files = append(config.Files, filename)
+	lines, err := readEntriesFromFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return append(entries, lines...), nil
+}
+
+// applyEnv overrides a configuration with the environment variables
+func applyEnv(config *Config) error {
+	var err error
+	if config.DelayBetweenRequests, err = getEnvAsDuration("DNSRBL_DELAY_REQUESTS", config.DelayBetweenRequests); err != nil {
+		return err
+	}
+	if config.DelayBetweenRuns, err = getEnvAsDuration("DNSRBL_DELAY_RUNS", config.DelayBetweenRuns); err != nil {
+		return err
+	}
+	if config.DelayBetweenListRequests, err = getEnvAsDuration("DNSRBL_DELAY_LIST_REQUESTS", config.DelayBetweenListRequests); err != nil {
+		return err
+	}
+	if config.Concurrency, err = getEnvAsInt("DNSRBL_CONCURRENCY", config.Concurrency); err != nil {
+		return err
+	}
+	if config.Jitter, err = getEnvAsInt("DNSRBL_JITTER", config.Jitter); err != nil {
+		return err
+	}
+	if config.MaxCIDRSize, err = getEnvAsInt("DNSRBL_MAX_CIDR_SIZE", config.MaxCIDRSize); err != nil {
+		return err
+	}
+
+	if os.Getenv("DNSRBL_PORT") != "" {
+		port, err := getEnvAsInt("DNSRBL_PORT", 0)
+		if err != nil {
+			return err
+		}
+		config.ListenAddress = fmt.Sprintf(":%d", port)
+	}
+	if value := os.Getenv("DNSRBL_LISTEN_ADDRESS"); value != "" {
+		config.ListenAddress = value
+	}
+	if value := os.Getenv("DNSRBL_HTTP_BL_ACCESS_KEY"); value != "" {
+		config.HTTPBLAccessKey = value
+	}
+	if value := os.Getenv("DNSRBL_STATE_FILE"); value != "" {
+		config.StateFile = value
+	}
+
+	// Load check targets
+	ips, ipsFile, err := readEntries("DNSRBL_CHECK_IP", "DNSRBL_CHECK_IP_FILENAME")
+	if err != nil {
+		return fmt.Errorf("failed to read check IP file: %w", err)
+	}
+	if ips != nil {
+		config.CheckIPs = ips
+	}
+	domains, domainsFile, err := readEntries("DNSRBL_CHECK_DOMAIN", "DNSRBL_CHECK_DOMAIN_FILENAME")
+	if err != nil {
+		return fmt.Errorf("failed to read check domain file: %w", err)
+	}
+	if domains != nil {
+		config.CheckDomains = domains
+	}
+	for _, filename := range []string{ipsFile, domainsFile} {
+		if filename != "" {
+			config.Files = append(config.Files, filename)
+		}
+	}
+
+	// Load blacklist lists
+	if lists := os.Getenv("DNSRBL_LISTS"); lists != "" {
+		if config.Lists, err = parseLists(strings.Fields(lists)); err != nil {
+			return fmt.Errorf("failed to read lists: %w", err)
+		}
+	} else if filename := os.Getenv("DNSRBL_LISTS_FILENAME"); filename != "" {
+		config.Files = append(config.Files, filename)
+		if config.Lists, err = readLists(filename); err != nil {
+			return fmt.Errorf("failed to read lists: %w", err)
+		}
+	}
+
+	// Load upstream resolvers
+	if resolvers := os.Getenv("DNSRBL_RESOLVERS"); resolvers != "" {
+		config.Resolvers = splitList(resolvers)
+	}
+	if mode := os.Getenv("DNSRBL_RESOLVER_MODE"); mode != "" {
+		config.ResolverMode = mode
+	}
+
+	// Add webhooks without further settings
+	for _, env := range []struct {
+		key    string
+		format string
+	}{
+		{"DNSRBL_WEBHOOK_URLS", formatJSON},
+		{"DNSRBL_SLACK_WEBHOOK_URLS", formatSlack},
+		{"DNSRBL_TEAMS_WEBHOOK_URLS", formatTeams},
+	} {
+		for _, value := range splitList(os.Getenv(env.key)) {
+			webhook := Webhook{URL: value, Format: env.format, Timeout: defaultWebhookTimeout}
+			if err := webhook.validate(); err != nil {
+				return fmt.Errorf("invalid %s: %w", env.key, err)
+			}
+			config.Notifications.Webhooks = append(config.Notifications.Webhooks, webhook)
+		}
+	}
+	if urls := os.Getenv("DNSRBL_ALERTMANAGER_URLS"); urls != "" {
+		alertmanager := Alertmanager{ResendInterval: defaultAlertResendInterval, Timeout: defaultWebhookTimeout}
+		if config.Notifications.Alertmanager != nil {
+			alertmanager = *config.Notifications.Alertmanager
+		}
+		alertmanager.URLs = splitList(urls)
+		if err := alertmanager.validate(); err != nil {
+			return fmt.Errorf("invalid DNSRBL_ALERTMANAGER_URLS: %w", err)
+		}
+		config.Notifications.Alertmanager = &alertmanager
+	}
+
+	return nil
+}
+
+// validate checks a configuration for invalid values
+func (c *Config) validate() error {
+	if _, port, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", c.ListenAddress, err)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid listen address %q: invalid port", c.ListenAddress)
+	}
+
+	if c.DelayBetweenRuns <= 0 {
+		return fmt.Errorf("invalid delay between runs %v: must be positive", c.DelayBetweenRuns)
+	}
+	if c.DelayBetweenRequests < 0 {
+		return fmt.Errorf("invalid delay between requests %v: must not be negative", c.DelayBetweenRequests)
+	}
+	if c.DelayBetweenListRequests < 0 {
+		return fmt.Errorf("invalid delay between list requests %v: must not be negative", c.DelayBetweenListRequests)
+	}
+	if c.Concurrency < 1 {
+		return fmt.Errorf("invalid concurrency %d: must be at least 1", c.Concurrency)
+	}
+	if c.Jitter < 0 || c.Jitter > 100 {
+		return fmt.Errorf("invalid jitter %d: must be between 0 and 100", c.Jitter)
+	}
+	if c.MaxCIDRSize < 1 {
+		return fmt.Errorf("invalid max CIDR size %d: must be at least 1", c.MaxCIDRSize)
+	}
+
+	for _, resolver := range c.Resolvers {
+		if _, err := parseResolver(resolver); err != nil {
+			return fmt.Errorf("failed to parse resolvers: %w", err)
+		}
+	}
+	switch c.ResolverMode {
+	case resolverModeRecursive, resolverModeAuthoritative:
+	default:
+		return fmt.Errorf("invalid resolver mode: %s", c.ResolverMode)
+	}
+
+	if c.Notifications.Retries < 0 {
+		return fmt.Errorf("invalid notification retries %d: must not be negative", c.Notifications.Retries)
+	}
+
+	return nil
+}
+
+// getEnvAsInt returns an integer environment variable or the default value if unset
+func getEnvAsInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	intVal, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be an integer", key, value)
+	}
+	return intVal, nil
+}
+
+// getEnvAsDuration returns a duration environment variable or the default value if unset
+func getEnvAsDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := parseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be a number of seconds or a duration such as 60s", key, value)
+	}
+	return duration, nil
+}
+
+// parseDuration parses a duration such as "90s" or "15m", plain numbers are seconds
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
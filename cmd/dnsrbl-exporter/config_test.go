@@ -0,0 +1,360 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mustLoadConfig loads a configuration and fails the test on errors
+func mustLoadConfig(t *testing.T, filename string) *Config {
+	t.Helper()
+
+	config, err := loadConfig(filename)
+	if err != nil {
+		t.Fatalf("loadConfig(%q) unexpected error: %v", filename, err)
+	}
+	return config
+}
+
+func TestLoadConfig_File(t *testing.T) {
+	os.Setenv("TEST_CONFIG_KEY", "secretkey")
+	defer os.Unsetenv("TEST_CONFIG_KEY")
+
+	ips := writeTestFile(t, "ips.txt", "# relays\n10.0.0.1\n10.0.0.2\n")
+	filename := writeTestFile(t, "config.yaml", `
+listen_address: 127.0.0.1:9100
+targets:
+  ips: [192.168.1.1]
+  ips_file: `+ips+`
+  domains: [example.com]
+max_cidr_size: 16
+lists:
+  - zone: zen.spamhaus.org
+    ipv6: true
+    severity: 10
+  - zone: dbl.spamhaus.org
+    type: domain
+resolvers: [1.1.1.1, tls://9.9.9.9]
+resolver_mode: authoritative
+intervals:
+  runs: 5m
+  requests: 500ms
+  list_requests: 2
+concurrency: 4
+jitter: 0
+http_bl_access_key: ${TEST_CONFIG_KEY}
+state_file: /var/lib/dnsrbl-exporter/state.db
+`)
+
+	config := mustLoadConfig(t, filename)
+
+	if config.ListenAddress != "127.0.0.1:9100" {
+		t.Errorf("ListenAddress = %q; want %q", config.ListenAddress, "127.0.0.1:9100")
+	}
+	if len(config.CheckIPs) != 3 || config.CheckIPs[2] != "10.0.0.2" {
+		t.Errorf("CheckIPs = %q; want 3 entries", config.CheckIPs)
+	}
+	if len(config.Targets) != 4 || config.CheckIPMode != "static" {
+		t.Errorf("Targets = %+v, CheckIPMode = %q; want 4 static targets", config.Targets, config.CheckIPMode)
+	}
+	if config.MaxCIDRSize != 16 {
+		t.Errorf("MaxCIDRSize = %d; want %d", config.MaxCIDRSize, 16)
+	}
+	if len(config.Lists) != 2 || config.Lists[0].Severity != 10 || config.Lists[1].Type != listTypeDomain {
+		t.Errorf("Lists = %+v", config.Lists)
+	}
+	if len(config.Resolvers) != 2 || config.ResolverMode != resolverModeAuthoritative {
+		t.Errorf("Resolvers = %q, ResolverMode = %q", config.Resolvers, config.ResolverMode)
+	}
+	if config.DelayBetweenRuns != 5*time.Minute {
+		t.Errorf("DelayBetweenRuns = %v; want %v", config.DelayBetweenRuns, 5*time.Minute)
+	}
+	if config.DelayBetweenRequests != 500*time.Millisecond {
+		t.Errorf("DelayBetweenRequests = %v; want %v", config.DelayBetweenRequests, 500*time.Millisecond)
+	}
+	if config.DelayBetweenListRequests != 2*time.Second {
+		t.Errorf("DelayBetweenListRequests = %v; want %v", config.DelayBetweenListRequests, 2*time.Second)
+	}
+	if config.Concurrency != 4 || config.Jitter != 0 {
+		t.Errorf("Concurrency = %d, Jitter = %d; want 4, 0", config.Concurrency, config.Jitter)
+	}
+	if len(config.Files) != 2 || config.Files[0] != filename || config.Files[1] != ips {
+		t.Errorf("Files = %q; want %q", config.Files, []string{filename, ips})
+	}
+	if config.HTTPBLAccessKey != "secretkey" {
+		t.Errorf("HTTPBLAccessKey = %q; want %q", config.HTTPBLAccessKey, "secretkey")
+	}
+	if config.StateFile != "/var/lib/dnsrbl-exporter/state.db" {
+		t.Errorf("StateFile = %q; want %q", config.StateFile, "/var/lib/dnsrbl-exporter/state.db")
+	}
+}
+
+func TestLoadConfig_EnvOverridesFile(t *testing.T) {
+	filename := writeTestFile(t, "config.yaml", `
+listen_address: :9100
+targets:
+  ips: [192.168.1.1]
+lists:
+  - zone: zen.spamhaus.org
+intervals:
+  runs: 5m
+concurrency: 4
+`)
+
+	os.Setenv("DNSRBL_CHECK_IP", "10.0.0.1")
+	os.Setenv("DNSRBL_LISTS", "bl.spamcop.net")
+	os.Setenv("DNSRBL_DELAY_RUNS", "90s")
+	os.Setenv("DNSRBL_PORT", "9200")
+	defer func() {
+		os.Unsetenv("DNSRBL_CHECK_IP")
+		os.Unsetenv("DNSRBL_LISTS")
+		os.Unsetenv("DNSRBL_DELAY_RUNS")
+		os.Unsetenv("DNSRBL_PORT")
+	}()
+
+	config := mustLoadConfig(t, filename)
+
+	if len(config.CheckIPs) != 1 || config.CheckIPs[0] != "10.0.0.1" {
+		t.Errorf("CheckIPs = %q; want %q", config.CheckIPs, []string{"10.0.0.1"})
+	}
+	if len(config.Lists) != 1 || config.Lists[0].Zone != "bl.spamcop.net" {
+		t.Errorf("Lists = %+v; want bl.spamcop.net", config.Lists)
+	}
+	if config.DelayBetweenRuns != 90*time.Second {
+		t.Errorf("DelayBetweenRuns = %v; want %v", config.DelayBetweenRuns, 90*time.Second)
+	}
+	if config.ListenAddress != ":9200" {
+		t.Errorf("ListenAddress = %q; want %q", config.ListenAddress, ":9200")
+	}
+	if config.Concurrency != 4 {
+		t.Errorf("Concurrency = %d; want %d", config.Concurrency, 4)
+	}
+}
+
+func TestLoadConfig_Modules(t *testing.T) {
+	filename := writeTestFile(t, "config.yaml", `
+targets:
+  ips: [192.0.2.1@web, 192.0.2.2]
+  domains: [example.com@web]
+lists:
+  - zone: zen.spamhaus.org
+  - zone: bl.spamcop.net
+  - zone: dbl.spamhaus.org
+    type: domain
+modules:
+  web:
+    lists: [bl.spamcop.net, dbl.spamhaus.org]
+    interval: 1h
+`)
+
+	config := mustLoadConfig(t, filename)
+
+	module, ok := config.Modules["web"]
+	if !ok || len(module.Lists) != 2 || module.Interval != time.Hour {
+		t.Fatalf("Modules = %+v", config.Modules)
+	}
+	if config.Targets[0].Module != "web" || config.Targets[1].Module != "" || config.Targets[2].Module != "web" {
+		t.Errorf("Targets = %+v", config.Targets)
+	}
+	if jobs := checkJobs(config.Targets, config.Lists, config.Modules); len(jobs) != 4 {
+		t.Errorf("checkJobs() returned %d pairs; want %d", len(jobs), 4)
+	}
+}
+
+func TestLoadConfig_Notifications(t *testing.T) {
+	filename := writeTestFile(t, "config.yaml", `
+lists:
+  - zone: zen.spamhaus.org
+notifications:
+  retries: 5
+  backoff: 2s
+  notify_initial: false
+  webhooks:
+    - url: https://hooks.example.com/dnsrbl
+      timeout: 5s
+  email:
+    smarthost: smtp.example.com:587
+    from: dnsrbl@example.com
+    to: [postmaster@example.com]
+    digest: 15m
+`)
+	t.Setenv("DNSRBL_WEBHOOK_URLS", "http://localhost:9000/a, http://localhost:9000/b")
+
+	config := mustLoadConfig(t, filename)
+
+	notifications := config.Notifications
+	if notifications.Retries != 5 || notifications.Backoff != 2*time.Second || notifications.DedupWindow != defaultDedupWindow ||
+		notifications.NotifyInitial {
+		t.Errorf("Notifications = %+v", notifications)
+	}
+	if len(notifications.Webhooks) != 3 {
+		t.Fatalf("got %d webhooks; want %d", len(notifications.Webhooks), 3)
+	}
+	if notifications.Webhooks[0].Timeout != 5*time.Second || notifications.Webhooks[2].URL != "http://localhost:9000/b" {
+		t.Errorf("Webhooks = %+v", notifications.Webhooks)
+	}
+	if email := notifications.Email; email == nil || email.TLS != emailTLSStartTLS || email.Digest != 15*time.Minute {
+		t.Errorf("Email = %+v", email)
+	}
+}
+
+func TestLoadConfig_Alertmanager(t *testing.T) {
+	filename := writeTestFile(t, "config.yaml", `
+lists:
+  - zone: zen.spamhaus.org
+notifications:
+  alertmanager:
+    urls: [http://alertmanager-a:9093]
+    labels:
+      site: edge-1
+    resend_interval: 30s
+`)
+	t.Setenv("DNSRBL_ALERTMANAGER_URLS", "http://alertmanager-b:9093, http://alertmanager-c:9093")
+
+	config := mustLoadConfig(t, filename)
+
+	alertmanager := config.Notifications.Alertmanager
+	if alertmanager == nil {
+		t.Fatal("Alertmanager not configured")
+	}
+	if len(alertmanager.URLs) != 2 || alertmanager.URLs[0] != "http://alertmanager-b:9093" {
+		t.Errorf("URLs = %v; want the URLs of DNSRBL_ALERTMANAGER_URLS", alertmanager.URLs)
+	}
+	if alertmanager.Labels["site"] != "edge-1" || alertmanager.ResendInterval != 30*time.Second {
+		t.Errorf("Alertmanager = %+v", alertmanager)
+	}
+}
+
+func TestLoadConfig_DuplicateZones(t *testing.T) {
+	tests := []struct {
+		name  string
+		lists string
+		file  string
+	}{
+		{name: "inline and lists file", lists: "zen.spamhaus.org\n", file: "lists:\n  - zone: zen.spamhaus.org\n"},
+		{name: "within plain text file", lists: "zen.spamhaus.org\nbl.spamcop.net\nzen.spamhaus.org:ipv6\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lists := writeTestFile(t, "lists.txt", tt.lists)
+			filename := writeTestFile(t, "config.yaml", tt.file+"lists_file: "+lists+"\n")
+			_, err := loadConfig(filename)
+			if err == nil || !strings.Contains(err.Error(), "duplicate list zone zen.spamhaus.org") {
+				t.Errorf("loadConfig() error = %v; want duplicate zone", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_InvalidFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "unknown key", content: "lists:\n  - zone: zen.spamhaus.org\nlisten: :8000\n"},
+		{name: "unknown list key", content: "lists:\n  - zone: zen.spamhaus.org\n    colour: red\n"},
+		{name: "invalid interval", content: "lists:\n  - zone: zen.spamhaus.org\nintervals:\n  runs: hourly\n"},
+		{name: "zero run interval", content: "lists:\n  - zone: zen.spamhaus.org\nintervals:\n  runs: 0s\n"},
+		{name: "negative request delay", content: "lists:\n  - zone: zen.spamhaus.org\nintervals:\n  requests: -1s\n"},
+		{name: "invalid concurrency", content: "lists:\n  - zone: zen.spamhaus.org\nconcurrency: 0\n"},
+		{name: "invalid jitter", content: "lists:\n  - zone: zen.spamhaus.org\njitter: 150\n"},
+		{name: "invalid listen address", content: "lists:\n  - zone: zen.spamhaus.org\nlisten_address: localhost\n"},
+		{name: "invalid resolver", content: "lists:\n  - zone: zen.spamhaus.org\nresolvers: [quic://10.0.0.1]\n"},
+		{name: "invalid resolver mode", content: "lists:\n  - zone: zen.spamhaus.org\nresolver_mode: iterative\n"},
+		{name: "invalid target", content: "lists:\n  - zone: zen.spamhaus.org\ntargets:\n  ips: [not-an-ip]\n"},
+		{name: "duplicate list", content: "lists:\n  - zone: zen.spamhaus.org\n  - zone: zen.spamhaus.org\n"},
+		{name: "module with unknown list", content: "lists:\n  - zone: zen.spamhaus.org\nmodules:\n  web:\n    lists: [bl.spamcop.net]\n"},
+		{name: "target with unknown module", content: "lists:\n  - zone: zen.spamhaus.org\ntargets:\n  ips: [192.0.2.1@web]\n"},
+		{name: "wrong type", content: "lists:\n  - zone: zen.spamhaus.org\nconcurrency: many\n"},
+		{name: "invalid webhook", content: "lists:\n  - zone: zen.spamhaus.org\nnotifications:\n  webhooks:\n    - url: hooks.example.com\n"},
+		{name: "negative retries", content: "lists:\n  - zone: zen.spamhaus.org\nnotifications:\n  retries: -1\n"},
+		{name: "invalid email", content: "lists:\n  - zone: zen.spamhaus.org\nnotifications:\n  email:\n    smarthost: smtp.example.com\n"},
+		{name: "invalid alertmanager", content: "lists:\n  - zone: zen.spamhaus.org\nnotifications:\n  alertmanager:\n    urls: [alertmanager:9093]\n"},
+		{name: "invalid backoff", content: "lists:\n  - zone: zen.spamhaus.org\nnotifications:\n  backoff: fast\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeTestFile(t, "config.yaml", tt.content)
+			if _, err := loadConfig(filename); err == nil {
+				t.Errorf("loadConfig() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestLoadConfig_InvalidEnv(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{key: "DNSRBL_DELAY_RUNS", value: "soon"},
+		{key: "DNSRBL_DELAY_REQUESTS", value: "-1"},
+		{key: "DNSRBL_CONCURRENCY", value: "4x"},
+		{key: "DNSRBL_JITTER", value: "-5"},
+		{key: "DNSRBL_PORT", value: "http"},
+		{key: "DNSRBL_MAX_CIDR_SIZE", value: "0"},
+		{key: "DNSRBL_RESOLVER_MODE", value: "iterative"},
+		{key: "DNSRBL_WEBHOOK_URLS", value: "hooks.example.com"},
+		{key: "DNSRBL_ALERTMANAGER_URLS", value: "alertmanager:9093"},
+	}
+
+	os.Setenv("DNSRBL_LISTS", "zen.spamhaus.org")
+	defer os.Unsetenv("DNSRBL_LISTS")
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			os.Setenv(tt.key, tt.value)
+			defer os.Unsetenv(tt.key)
+
+			if _, err := loadConfig(""); err == nil {
+				t.Errorf("loadConfig() with %s=%q expected error but got none", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_MissingFile(t *testing.T) {
+	if _, err := loadConfig("/non/existent/config.yaml"); err == nil {
+		t.Error("loadConfig() expected error for non-existent file but got none")
+	}
+}
+
+func TestGetEnvAsDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{name: "default when empty", value: "", expected: time.Minute},
+		{name: "seconds", value: "90", expected: 90 * time.Second},
+		{name: "duration", value: "60s", expected: 60 * time.Second},
+		{name: "minutes", value: "15m", expected: 15 * time.Minute},
+		{name: "invalid", value: "60 seconds", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("TEST_DURATION", tt.value)
+			defer os.Unsetenv("TEST_DURATION")
+
+			result, err := getEnvAsDuration("TEST_DURATION", time.Minute)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("getEnvAsDuration() with %q expected error but got none", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getEnvAsDuration() with %q unexpected error: %v", tt.value, err)
+			}
+			if result != tt.expected {
+				t.Errorf("getEnvAsDuration() with %q = %v; want %v", tt.value, result, tt.expected)
+			}
+		})
+	}
+}
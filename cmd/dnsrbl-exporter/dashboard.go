@@ -0,0 +1,145 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed templates/dashboard.html
+var templateFiles embed.FS
+
+var dashboardTemplate = template.Must(template.New("dashboard.html").Funcs(template.FuncMap{
+	"formatTime": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05 MST") },
+	"join":       strings.Join,
+}).ParseFS(templateFiles, "templates/dashboard.html"))
+
+// dashboardColumn is a list of the dashboard matrix
+type dashboardColumn struct {
+	Zone     string
+	Name     string
+	Homepage string
+}
+
+// dashboardCell is the latest result of a target on a list, if any
+type dashboardCell struct {
+	Status    *CheckStatus
+	Class     string
+	DelistURL string
+}
+
+// dashboardRow is a target of the dashboard matrix
+type dashboardRow struct {
+	Target string
+	Module string
+	Cells  []dashboardCell
+}
+
+// dashboardData is rendered by the dashboard template
+type dashboardData struct {
+	Updated time.Time
+	Version string
+	Summary StatusSummary
+	Lists   []dashboardColumn
+	Rows    []dashboardRow
+}
+
+// dashboard serves a read-only HTML page showing the latest results as a
+// matrix of targets and lists
+type dashboard struct {
+	mu    sync.RWMutex
+	lists []List
+	store *resultStore
+}
+
+func newDashboard(config *Config, store *resultStore) *dashboard {
+	return &dashboard{lists: config.Lists, store: store}
+}
+
+// update replaces the lists shown by the dashboard
+func (d *dashboard) update(config *Config) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lists = config.Lists
+}
+
+func (d *dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	lists := d.lists
+	d.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, buildDashboard(lists, d.store.all(), time.Now())); err != nil {
+		log.Printf("Failed to render dashboard: %v", err)
+	}
+}
+
+// buildDashboard arranges results in a matrix of targets and lists
+func buildDashboard(lists []List, results []CheckStatus, now time.Time) dashboardData {
+	data := dashboardData{
+		Updated: now,
+		Version: Version,
+		Summary: summarize(results),
+	}
+
+	columns := make(map[string]int, len(lists))
+	delistURLs := make(map[string]string, len(lists))
+	for _, list := range lists {
+		columns[list.Zone] = len(data.Lists)
+		delistURLs[list.Zone] = list.DelistURL
+		data.Lists = append(data.Lists, dashboardColumn{
+			Zone:     list.Zone,
+			Name:     list.displayName(),
+			Homepage: list.Homepage,
+		})
+	}
+
+	rows := make(map[string]*dashboardRow)
+	for i := range results {
+		result := &results[i]
+		column, ok := columns[result.List]
+		if !ok {
+			continue
+		}
+
+		row, ok := rows[result.Target]
+		if !ok {
+			row = &dashboardRow{
+				Target: result.Target,
+				Module: result.Module,
+				Cells:  make([]dashboardCell, len(data.Lists)),
+			}
+			rows[result.Target] = row
+		}
+		row.Cells[column] = dashboardCell{
+			Status:    result,
+			Class:     statusClass(result.Result),
+			DelistURL: delistURLs[result.List],
+		}
+	}
+
+	for _, row := range rows {
+		data.Rows = append(data.Rows, *row)
+	}
+	sort.Slice(data.Rows, func(i, j int) bool { return data.Rows[i].Target < data.Rows[j].Target })
+	return data
+}
+
+// statusClass returns the CSS class of a result
+func statusClass(result string) string {
+	switch result {
+	case "Found":
+		return "listed"
+	case "NXDOMAIN":
+		return "ok"
+	case "Refused":
+		return "refused"
+	}
+	return "error"
+}
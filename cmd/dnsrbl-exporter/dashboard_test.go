@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildDashboard(t *testing.T) {
+	lists := []List{
+		{Zone: "zen.spamhaus.org", Name: "Spamhaus ZEN", DelistURL: "https://check.spamhaus.org/"},
+		{Zone: "bl.spamcop.net"},
+	}
+	results := newTestResultStore().all()
+
+	data := buildDashboard(lists, results, time.Now())
+
+	if len(data.Lists) != 2 || data.Lists[0].Name != "Spamhaus ZEN" || data.Lists[1].Name != "bl.spamcop.net" {
+		t.Errorf("Lists = %+v", data.Lists)
+	}
+	if len(data.Rows) != 2 || data.Rows[0].Target != "192.0.2.1" || data.Rows[1].Target != "2001:db8::1" {
+		t.Fatalf("Rows = %+v", data.Rows)
+	}
+
+	cells := data.Rows[0].Cells
+	if cells[0].Class != "listed" || cells[0].DelistURL != "https://check.spamhaus.org/" || cells[1].Class != "ok" {
+		t.Errorf("Rows[0].Cells = %+v", cells)
+	}
+	if data.Rows[0].Module != "mail" {
+		t.Errorf("Rows[0].Module = %q; want %q", data.Rows[0].Module, "mail")
+	}
+
+	// IPv6 target only checked against Spamhaus
+	cells = data.Rows[1].Cells
+	if cells[0].Class != "error" || cells[1].Status != nil {
+		t.Errorf("Rows[1].Cells = %+v", cells)
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := map[string]string{
+		"Found":    "listed",
+		"NXDOMAIN": "ok",
+		"Refused":  "refused",
+		"Timeout":  "error",
+		"NoAnswer": "error",
+	}
+	for result, expected := range tests {
+		if got := statusClass(result); got != expected {
+			t.Errorf("statusClass(%q) = %q; want %q", result, got, expected)
+		}
+	}
+}
+
+func TestDashboardHandler(t *testing.T) {
+	store := newTestResultStore()
+	store.set(checkJob{Target: Target{IP: "192.0.2.9"}, List: List{Zone: "bl.spamcop.net"}}, checkResult{
+		Result: "Found",
+		Reason: `<script>alert("listed")</script>`,
+	}, time.Now())
+	config := &Config{Lists: []List{
+		{Zone: "zen.spamhaus.org", DelistURL: "https://check.spamhaus.org/"},
+		{Zone: "bl.spamcop.net", Homepage: "https://www.spamcop.net/"},
+	}}
+
+	rec := httptest.NewRecorder()
+	newDashboard(config, store).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q; want text/html", ct)
+	}
+
+	body := rec.Body.String()
+	for _, expected := range []string{
+		"192.0.2.1",
+		"2001:db8::1",
+		`<a href="https://check.spamhaus.org/">listed</a>`,
+		`<a href="https://www.spamcop.net/">bl.spamcop.net</a>`,
+		"3 targets checked against 2 lists",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("dashboard missing %q", expected)
+		}
+	}
+	if strings.Contains(body, "<script>") {
+		t.Error("dashboard contains unescaped listing reason")
+	}
+}
+
+func TestDashboardHandler_Empty(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newDashboard(&Config{}, newResultStore()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !strings.Contains(rec.Body.String(), "No checks have completed yet") {
+		t.Errorf("empty dashboard = %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// returnCodes maps the answers of a blacklist to named sub-lists, either by
+// exact answer or by bits set in the last octet of the answer. Refused holds
+// the answers a blacklist returns when it refuses to answer a query.
+type returnCodes struct {
+	Codes   map[string]string
+	Bitmask map[int]string
+	Refused []string
+}
+
+var (
+	// Spamhaus refuses queries with typing errors in the DQS key, queries
+	// through public resolvers and queries exceeding the free usage limit
+	spamhausRefusedCodes = []string{"127.255.255.252", "127.255.255.254", "127.255.255.255"}
+
+	spamhausIPReturnCodes = returnCodes{
+		Codes: map[string]string{
+			"127.0.0.2":  "sbl",
+			"127.0.0.3":  "css",
+			"127.0.0.4":  "xbl",
+			"127.0.0.9":  "drop",
+			"127.0.0.10": "pbl",
+			"127.0.0.11": "pbl",
+		},
+		Refused: spamhausRefusedCodes,
+	}
+
+	// knownReturnCodes holds the decoding tables of well-known blacklists
+	knownReturnCodes = map[string]returnCodes{
+		"zen.spamhaus.org":     spamhausIPReturnCodes,
+		"sbl.spamhaus.org":     spamhausIPReturnCodes,
+		"xbl.spamhaus.org":     spamhausIPReturnCodes,
+		"pbl.spamhaus.org":     spamhausIPReturnCodes,
+		"sbl-xbl.spamhaus.org": spamhausIPReturnCodes,
+		"dbl.spamhaus.org": {
+			Codes: map[string]string{
+				"127.0.1.2":   "spam",
+				"127.0.1.4":   "phish",
+				"127.0.1.5":   "malware",
+				"127.0.1.6":   "botnet_cc",
+				"127.0.1.102": "abused_spam",
+				"127.0.1.103": "abused_redirector",
+				"127.0.1.104": "abused_phish",
+				"127.0.1.105": "abused_malware",
+				"127.0.1.106": "abused_botnet_cc",
+			},
+			Refused: spamhausRefusedCodes,
+		},
+		"multi.surbl.org": {
+			Bitmask: map[int]string{
+				8:   "ph",
+				16:  "mw",
+				64:  "abuse",
+				128: "cr",
+			},
+			Refused: []string{"127.0.0.1"},
+		},
+		"dnsbl.httpbl.org": {
+			Bitmask: map[int]string{
+				1: "suspicious",
+				2: "harvester",
+				4: "comment_spammer",
+			},
+		},
+		"multi.uribl.com": {
+			Bitmask: map[int]string{
+				2: "black",
+				4: "grey",
+				8: "red",
+			},
+			Refused: []string{"127.0.0.1"},
+		},
+	}
+)
+
+// isRefused reports whether the answers of a blacklist contain a refusal code
+func isRefused(list List, answers []string) bool {
+	for _, answer := range answers {
+		for _, refused := range list.returnCodes().Refused {
+			if answer == refused {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeAnswers returns the sorted, unique sub-lists of a blacklist's answers.
+// Answers without a known meaning are returned as they are.
+func decodeAnswers(list List, answers []string) []string {
+	codes := list.returnCodes()
+	seen := make(map[string]bool)
+
+	for _, answer := range answers {
+		if sublist, ok := codes.Codes[answer]; ok {
+			seen[sublist] = true
+			continue
+		}
+
+		decoded := false
+		if ip := net.ParseIP(answer).To4(); ip != nil && len(codes.Bitmask) > 0 {
+			for bit, sublist := range codes.Bitmask {
+				if int(ip[3])&bit != 0 {
+					seen[sublist] = true
+					decoded = true
+				}
+			}
+		}
+
+		if !decoded {
+			seen[answer] = true
+		}
+	}
+
+	sublists := make([]string, 0, len(seen))
+	for sublist := range seen {
+		sublists = append(sublists, sublist)
+	}
+	sort.Strings(sublists)
+	return sublists
+}
+
+// setListed replaces the sub-list series of a target on a blacklist
+func setListed(vec *prometheus.GaugeVec, targetLabel, blacklist, target string, sublists []string) {
+	vec.DeletePartialMatch(prometheus.Labels{"list": blacklist, targetLabel: target})
+	for _, sublist := range sublists {
+		vec.WithLabelValues(blacklist, target, sublist).Set(1)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDecodeAnswers(t *testing.T) {
+	tests := []struct {
+		name      string
+		blacklist string
+		answers   []string
+		expected  []string
+	}{
+		{
+			name:      "spamhaus zen pbl",
+			blacklist: "zen.spamhaus.org",
+			answers:   []string{"127.0.0.10", "127.0.0.11"},
+			expected:  []string{"pbl"},
+		},
+		{
+			name:      "spamhaus zen multiple sub-lists",
+			blacklist: "zen.spamhaus.org",
+			answers:   []string{"127.0.0.4", "127.0.0.2", "127.0.0.10"},
+			expected:  []string{"pbl", "sbl", "xbl"},
+		},
+		{
+			name:      "surbl bitmask",
+			blacklist: "multi.surbl.org",
+			answers:   []string{"127.0.0.24"},
+			expected:  []string{"mw", "ph"},
+		},
+		{
+			name:      "uribl bitmask",
+			blacklist: "multi.uribl.com",
+			answers:   []string{"127.0.0.2"},
+			expected:  []string{"black"},
+		},
+		{
+			name:      "unknown code of known list",
+			blacklist: "zen.spamhaus.org",
+			answers:   []string{"127.0.0.99"},
+			expected:  []string{"127.0.0.99"},
+		},
+		{
+			name:      "unknown list",
+			blacklist: "bl.example.org",
+			answers:   []string{"127.0.0.2"},
+			expected:  []string{"127.0.0.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := decodeAnswers(List{Zone: tt.blacklist}, tt.answers)
+			if len(result) != len(tt.expected) {
+				t.Fatalf("decodeAnswers(%q, %q) = %q; want %q", tt.blacklist, tt.answers, result, tt.expected)
+			}
+			for i := range result {
+				if result[i] != tt.expected[i] {
+					t.Errorf("decodeAnswers(%q, %q) = %q; want %q", tt.blacklist, tt.answers, result, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeAnswers_CustomReturnCodes(t *testing.T) {
+	list := List{
+		Zone: "zen.spamhaus.org",
+		ReturnCodes: returnCodes{
+			Codes: map[string]string{"127.0.0.2": "custom"},
+		},
+	}
+
+	// A custom table replaces the built-in table of a well-known list
+	result := decodeAnswers(list, []string{"127.0.0.2", "127.0.0.10"})
+	if len(result) != 2 || result[0] != "127.0.0.10" || result[1] != "custom" {
+		t.Errorf("decodeAnswers() = %q; want %q", result, []string{"127.0.0.10", "custom"})
+	}
+	if isRefused(list, []string{"127.255.255.254"}) {
+		t.Error("isRefused() used the built-in refusal codes despite a custom table")
+	}
+}
+
+func TestIsRefused(t *testing.T) {
+	tests := []struct {
+		name      string
+		blacklist string
+		answers   []string
+		expected  bool
+	}{
+		{name: "spamhaus public resolver", blacklist: "zen.spamhaus.org", answers: []string{"127.255.255.254"}, expected: true},
+		{name: "spamhaus over quota", blacklist: "dbl.spamhaus.org", answers: []string{"127.255.255.255"}, expected: true},
+		{name: "spamhaus listing", blacklist: "zen.spamhaus.org", answers: []string{"127.0.0.2"}, expected: false},
+		{name: "uribl refused", blacklist: "multi.uribl.com", answers: []string{"127.0.0.1"}, expected: true},
+		{name: "uribl listing", blacklist: "multi.uribl.com", answers: []string{"127.0.0.2"}, expected: false},
+		{name: "unknown list", blacklist: "bl.example.org", answers: []string{"127.0.0.1"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := isRefused(List{Zone: tt.blacklist}, tt.answers); result != tt.expected {
+				t.Errorf("isRefused(%q, %q) = %v; want %v", tt.blacklist, tt.answers, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSetListed(t *testing.T) {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_listed"}, []string{"list", "ip", "sublist"})
+
+	setListed(vec, "ip", "zen.spamhaus.org", "192.0.2.1", []string{"pbl", "xbl"})
+	setListed(vec, "ip", "zen.spamhaus.org", "192.0.2.2", []string{"pbl"})
+	if got := testutil.CollectAndCount(vec); got != 3 {
+		t.Errorf("series count = %d; want %d", got, 3)
+	}
+
+	// Replacing the sub-lists removes stale series of the same target only
+	setListed(vec, "ip", "zen.spamhaus.org", "192.0.2.1", []string{"pbl"})
+	if got := testutil.CollectAndCount(vec); got != 2 {
+		t.Errorf("series count after replace = %d; want %d", got, 2)
+	}
+
+	setListed(vec, "ip", "zen.spamhaus.org", "192.0.2.1", nil)
+	if got := testutil.CollectAndCount(vec); got != 1 {
+		t.Errorf("series count after delisting = %d; want %d", got, 1)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// dohConn is a net.Conn handing DNS messages written by the Go resolver to a
+// DNS-over-HTTPS server (RFC 8484). As it is no net.PacketConn, the Go
+// resolver writes and reads length prefixed messages as it does over TCP.
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	client   *http.Client
+	deadline time.Time
+	request  bytes.Buffer
+	response *bytes.Reader
+}
+
+// Write buffers the query written by the resolver
+func (c *dohConn) Write(b []byte) (int, error) {
+	return c.request.Write(b)
+}
+
+// Read sends the buffered queries on first use and returns the answers
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.response == nil {
+		var response bytes.Buffer
+		for c.request.Len() > 0 {
+			if err := c.roundTrip(&response); err != nil {
+				return 0, err
+			}
+		}
+		c.response = bytes.NewReader(response.Bytes())
+	}
+	return c.response.Read(b)
+}
+
+// roundTrip posts the next length prefixed query and appends the length
+// prefixed answer to the response
+func (c *dohConn) roundTrip(response *bytes.Buffer) error {
+	var length uint16
+	if err := binary.Read(&c.request, binary.BigEndian, &length); err != nil {
+		return err
+	}
+	query := c.request.Next(int(length))
+
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(query))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("DNS-over-HTTPS server returned %s", resp.Status)
+	}
+
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(response, binary.BigEndian, uint16(len(answer))); err != nil {
+		return err
+	}
+	_, err = response.Write(answer)
+	return err
+}
+
+func (c *dohConn) Close() error { return nil }
+
+func (c *dohConn) LocalAddr() net.Addr { return dohAddr(c.url) }
+
+func (c *dohConn) RemoteAddr() net.Addr { return dohAddr(c.url) }
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *dohConn) SetReadDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+func (c *dohConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// dohAddr is the address of a DNS-over-HTTPS server
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+
+func (a dohAddr) String() string { return string(a) }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startTestDoHServer serves a zone over DNS-over-HTTPS and returns the server
+// and a counter of received queries
+func startTestDoHServer(t *testing.T, zone testDNSZone) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var queries atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "unsupported request", http.StatusBadRequest)
+			return
+		}
+		queries.Add(1)
+
+		query, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response, err := zone.answer(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &queries
+}
+
+func TestResolver_HTTPS(t *testing.T) {
+	zone := testDNSZone{
+		"2.0.0.127.bl.example.org": {"127.0.0.2", "127.0.0.4", "Listed, see https://bl.example.org/lookup"},
+	}
+	server, queries := startTestDoHServer(t, zone)
+
+	resolver, err := newResolver([]string{server.URL + "/dns-query"})
+	if err != nil {
+		t.Fatalf("newResolver() unexpected error: %v", err)
+	}
+	resolver.httpClient = server.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips, err := resolver.lookupIP(ctx, "2.0.0.127.bl.example.org.")
+	if err != nil {
+		t.Fatalf("lookupIP() unexpected error: %v", err)
+	}
+	if len(ips) != 2 {
+		t.Errorf("lookupIP() = %v; want 2 addresses", ips)
+	}
+
+	txt, err := resolver.lookupTXT(ctx, "2.0.0.127.bl.example.org.")
+	if err != nil {
+		t.Fatalf("lookupTXT() unexpected error: %v", err)
+	}
+	if len(txt) != 1 || txt[0] != "Listed, see https://bl.example.org/lookup" {
+		t.Errorf("lookupTXT() = %q", txt)
+	}
+
+	_, err = resolver.lookupIP(ctx, "1.0.0.127.bl.example.org.")
+	if result := classifyDNSError(err); result != "NXDOMAIN" {
+		t.Errorf("lookupIP() of unlisted IP = %q (%v); want NXDOMAIN", result, err)
+	}
+
+	if queries.Load() == 0 {
+		t.Error("DNS-over-HTTPS server received no queries")
+	}
+}
+
+func TestResolver_HTTPSServerError(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resolver, err := newResolver([]string{server.URL + "/dns-query"})
+	if err != nil {
+		t.Fatalf("newResolver() unexpected error: %v", err)
+	}
+	resolver.httpClient = server.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = resolver.lookupIP(ctx, "2.0.0.127.bl.example.org.")
+	if err == nil {
+		t.Fatal("lookupIP() expected error but got none")
+	}
+	if result := classifyDNSError(err); result == "NXDOMAIN" {
+		t.Errorf("server error classified as %q", result)
+	}
+}
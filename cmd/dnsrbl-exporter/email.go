@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLS modes of the SMTP connection
+const (
+	emailTLSStartTLS = "starttls" // upgrade a plain connection, usually on port 587
+	emailTLSImplicit = "tls"      // TLS from the start, usually on port 465
+	emailTLSNone     = "none"     // unencrypted, only for relays on the local host or network
+)
+
+// defaultEmailTimeout is the timeout of an SMTP session
+const defaultEmailTimeout = 30 * time.Second
+
+// Email sends listing events through an SMTP relay, either per event or
+// collected into a digest
+type Email struct {
+	Smarthost string // host:port of the relay
+	From      string
+	To        []string
+	Username  string
+	Password  string
+	TLS       string
+	RootCAs   *x509.CertPool // CAs of the relay certificate, the system CAs if nil
+	Digest    time.Duration  // Time events are collected for one email, 0 to send each event
+	Timeout   time.Duration
+}
+
+// configEmail is the email notifier of the configuration file
+type configEmail struct {
+	Smarthost string   `yaml:"smarthost"`
+	From      string   `yaml:"from"`
+	To        []string `yaml:"to"`
+	Username  string   `yaml:"username"`
+	Password  string   `yaml:"password"`
+	TLS       string   `yaml:"tls"`
+	CAFile    string   `yaml:"ca_file"`
+	Digest    string   `yaml:"digest"`
+	Timeout   string   `yaml:"timeout"`
+}
+
+// toEmail validates the email notifier of the configuration file. ${VAR}
+// references in the username and password are expanded from the environment.
+func (c configEmail) toEmail() (Email, error) {
+	email := Email{
+		Smarthost: c.Smarthost,
+		From:      c.From,
+		To:        c.To,
+		Username:  os.ExpandEnv(c.Username),
+		Password:  os.ExpandEnv(c.Password),
+		TLS:       c.TLS,
+		Timeout:   defaultEmailTimeout,
+	}
+	if email.TLS == "" {
+		email.TLS = emailTLSStartTLS
+	}
+
+	if host, port, err := net.SplitHostPort(email.Smarthost); err != nil || host == "" || port == "" {
+		return Email{}, fmt.Errorf("invalid smarthost %q: must be host:port", email.Smarthost)
+	}
+	if _, err := mail.ParseAddress(email.From); err != nil {
+		return Email{}, fmt.Errorf("invalid from address %q: %w", email.From, err)
+	}
+	if len(email.To) == 0 {
+		return Email{}, errors.New("no recipients")
+	}
+	for _, to := range email.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return Email{}, fmt.Errorf("invalid recipient %q: %w", to, err)
+		}
+	}
+	switch email.TLS {
+	case emailTLSStartTLS, emailTLSImplicit, emailTLSNone:
+	default:
+		return Email{}, fmt.Errorf("invalid tls mode %q: must be starttls, tls or none", email.TLS)
+	}
+	if email.Password != "" && email.Username == "" {
+		return Email{}, errors.New("password without username")
+	}
+	if host, _, _ := net.SplitHostPort(email.Smarthost); email.Username != "" && email.TLS == emailTLSNone && !isLocalhost(host) {
+		return Email{}, errors.New("authentication requires tls starttls or tls")
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return Email{}, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		email.RootCAs = x509.NewCertPool()
+		if !email.RootCAs.AppendCertsFromPEM(pem) {
+			return Email{}, fmt.Errorf("no certificates in CA file %s", c.CAFile)
+		}
+	}
+	for _, setting := range []struct {
+		key   string
+		value string
+		dest  *time.Duration
+	}{
+		{"digest", c.Digest, &email.Digest},
+		{"timeout", c.Timeout, &email.Timeout},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		duration, err := parseDuration(setting.value)
+		if err != nil || duration < 0 || (setting.key == "timeout" && duration == 0) {
+			return Email{}, fmt.Errorf("invalid %s %q", setting.key, setting.value)
+		}
+		*setting.dest = duration
+	}
+
+	return email, nil
+}
+
+// isLocalhost reports whether a host is the local host, the only host
+// net/smtp sends credentials to without TLS
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// name returns the relay for logging
+func (e Email) name() string {
+	return "smtp://" + e.Smarthost
+}
+
+// queuedMail is a claimed notification waiting for the next email digest
+type queuedMail struct {
+	claim        claim
+	notification Notification
+}
+
+// queueDigest adds a notification to the next digest, which is sent after the
+// digest interval. The lock must be held.
+func (n *notifier) queueDigest(mail queuedMail, interval time.Duration) {
+	n.digest = append(n.digest, mail)
+	if len(n.digest) == 1 {
+		n.wg.Add(1)
+		time.AfterFunc(interval, n.sendDigest)
+	}
+}
+
+// sendDigest sends all queued notifications in one email
+func (n *notifier) sendDigest() {
+	defer n.wg.Done()
+
+	n.mu.Lock()
+	queued := n.digest
+	n.digest = nil
+	email := n.notifications.Email
+	retries, backoff := n.notifications.Retries, n.notifications.Backoff
+	n.mu.Unlock()
+
+	err := errors.New("email notifications are no longer configured")
+	if email != nil {
+		notifications := make([]Notification, len(queued))
+		for i, mail := range queued {
+			notifications[i] = mail.notification
+		}
+		err = n.deliverMail(*email, notifications, retries, backoff)
+	}
+	for _, mail := range queued {
+		n.finish(mail.claim, err)
+	}
+}
+
+// deliverMail sends notifications in one email, retrying with exponential
+// backoff on connection errors and temporary SMTP errors
+func (n *notifier) deliverMail(email Email, notifications []Notification, retries int, backoff time.Duration) error {
+	message := emailMessage(email, notifications, time.Now())
+	return withRetries(email.name(), retries, backoff, func() (bool, error) {
+		return sendMail(email, message)
+	})
+}
+
+// sendMail sends a message through the relay and reports whether a failure
+// may be retried
+func sendMail(email Email, message []byte) (bool, error) {
+	host, _, _ := net.SplitHostPort(email.Smarthost)
+	tlsConfig := &tls.Config{ServerName: host, RootCAs: email.RootCAs}
+	dialer := &net.Dialer{Timeout: email.Timeout}
+
+	var conn net.Conn
+	var err error
+	if email.TLS == emailTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", email.Smarthost, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", email.Smarthost)
+	}
+	if err != nil {
+		return true, err
+	}
+	conn.SetDeadline(time.Now().Add(email.Timeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return true, err
+	}
+	defer client.Close()
+
+	if hostname, err := os.Hostname(); err == nil {
+		if err := client.Hello(hostname); err != nil {
+			return smtpRetry(err), err
+		}
+	}
+	if email.TLS == emailTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return false, errors.New("relay does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return false, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if email.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", email.Username, email.Password, host)); err != nil {
+			return smtpRetry(err), fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(envelopeAddress(email.From)); err != nil {
+		return smtpRetry(err), err
+	}
+	for _, to := range email.To {
+		if err := client.Rcpt(envelopeAddress(to)); err != nil {
+			return smtpRetry(err), err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return smtpRetry(err), err
+	}
+	if _, err := w.Write(message); err != nil {
+		return true, err
+	}
+	if err := w.Close(); err != nil {
+		return smtpRetry(err), err
+	}
+	return false, client.Quit()
+}
+
+// envelopeAddress returns the plain address of an address with display name,
+// e.g. postmaster@example.com for "Postmaster <postmaster@example.com>"
+func envelopeAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return parsed.Address
+	}
+	return address
+}
+
+// smtpRetry reports whether an SMTP error is temporary. Connection errors and
+// 4xx replies are retried, 5xx replies are permanent.
+func smtpRetry(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code < 500
+	}
+	return true
+}
+
+// emailMessage returns an email with one or more notifications
+func emailMessage(email Email, notifications []Notification, now time.Time) []byte {
+	subject := notifications[0].headline()
+	if len(notifications) > 1 {
+		listed := 0
+		for _, n := range notifications {
+			if n.Type == eventListed {
+				listed++
+			}
+		}
+		subject = fmt.Sprintf("%d listing changes: %d listed, %d delisted", len(notifications), listed, len(notifications)-listed)
+	}
+
+	var body bytes.Buffer
+	for i, n := range notifications {
+		if i > 0 {
+			body.WriteString("\r\n")
+		}
+		body.WriteString(n.headline() + "\r\n\r\n")
+		for _, f := range n.facts() {
+			body.WriteString(f.Name + ": " + f.Value + "\r\n")
+		}
+		if link := n.delistURL(); link != "" {
+			body.WriteString("Delisting: " + link + "\r\n")
+		}
+	}
+	body.WriteString("\r\n-- \r\nSent by dnsrbl-exporter " + Version + "\r\n")
+
+	var message bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", email.From},
+		{"To", strings.Join(email.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", "[dnsrbl] "+subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s.%d@dnsrbl-exporter>", notifications[0].ID, now.UnixNano())},
+		{"Auto-Submitted", "auto-generated"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	} {
+		message.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	message.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&message)
+	w.Write(body.Bytes())
+	w.Close()
+	return message.Bytes()
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeMail is a message received by the fake SMTP server
+type fakeMail struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+	user string
+}
+
+// fakeSMTP is a minimal SMTP server supporting STARTTLS and AUTH PLAIN
+type fakeSMTP struct {
+	listener  net.Listener
+	tlsConfig *tls.Config // enables STARTTLS if set
+	username  string      // requires AUTH PLAIN if set
+	password  string
+
+	mu       sync.Mutex
+	failures int // MAIL commands answered with a temporary error
+	messages []fakeMail
+}
+
+// startFakeSMTP serves a configured fake server on a listener, a new local
+// TCP listener if nil
+func startFakeSMTP(t *testing.T, server *fakeSMTP, listener net.Listener) *fakeSMTP {
+	t.Helper()
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+	}
+	server.listener = listener
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSMTP) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeSMTP) received() []fakeMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeMail(nil), s.messages...)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	text := textproto.NewConn(conn)
+	reply := func(line string) { text.PrintfLine("%s", line) }
+
+	var current fakeMail
+	authenticated := s.username == ""
+	reply("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			lines := []string{"250-fake"}
+			if s.tlsConfig != nil && !current.tls {
+				lines = append(lines, "250-STARTTLS")
+			}
+			lines = append(lines, "250-AUTH PLAIN", "250 8BITMIME")
+			for _, l := range lines {
+				reply(l)
+			}
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			current.tls = true
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			parts := strings.Split(string(decoded), "\x00")
+			if len(parts) == 3 && parts[1] == s.username && parts[2] == s.password {
+				authenticated = true
+				current.user = parts[1]
+				reply("235 authenticated")
+			} else {
+				reply("535 invalid credentials")
+			}
+		case "MAIL":
+			s.mu.Lock()
+			fail := s.failures > 0
+			if fail {
+				s.failures--
+			}
+			s.mu.Unlock()
+			switch {
+			case !authenticated:
+				reply("530 authentication required")
+			case fail:
+				reply("451 try again later")
+			default:
+				current.from, _, _ = strings.Cut(strings.TrimPrefix(arg, "FROM:<"), ">")
+				reply("250 ok")
+			}
+		case "RCPT":
+			to, _, _ := strings.Cut(strings.TrimPrefix(arg, "TO:<"), ">")
+			current.to = append(current.to, to)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			current.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			current = fakeMail{tls: current.tls, user: current.user}
+			reply("250 queued")
+		case "RSET", "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and the
+// name of a PEM file holding it
+func testCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, filename
+}
+
+// decodeMail parses a received message and decodes its body
+func decodeMail(t *testing.T, data string) (*mail.Message, string) {
+	t.Helper()
+	message, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(message.Body))
+	if err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	return message, string(body)
+}
+
+func TestEmailStartTLSAuth(t *testing.T) {
+	cert, caFile := testCertificate(t)
+	server := startFakeSMTP(t, &fakeSMTP{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		username:  "dnsrbl",
+		password:  "secret",
+	}, nil)
+	t.Setenv("TEST_SMTP_PASSWORD", "secret")
+
+	email, err := configEmail{
+		Smarthost: server.addr(),
+		From:      "DNSRBL Exporter <dnsrbl@example.com>",
+		To:        []string{"postmaster@example.com"},
+		Username:  "dnsrbl",
+		Password:  "${TEST_SMTP_PASSWORD}",
+		CAFile:    caFile,
+	}.toEmail()
+	if err != nil {
+		t.Fatalf("toEmail() error = %v", err)
+	}
+	n := newNotifier(Notifications{Email: &email})
+
+	n.notify(testEvent(eventListed, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)), testList)
+	n.wait()
+
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("received %d emails; want 1", len(messages))
+	}
+	received := messages[0]
+	if !received.tls || received.user != "dnsrbl" {
+		t.Errorf("tls = %v, user = %q; want STARTTLS and authentication", received.tls, received.user)
+	}
+	if received.from != "dnsrbl@example.com" || len(received.to) != 1 || received.to[0] != "postmaster@example.com" {
+		t.Errorf("envelope from %q to %q", received.from, received.to)
+	}
+
+	message, body := decodeMail(t, received.data)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if subject != "[dnsrbl] 192.0.2.1 is listed in Spamhaus ZEN" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if message.Header.Get("From") != "DNSRBL Exporter <dnsrbl@example.com>" || message.Header.Get("Auto-Submitted") != "auto-generated" {
+		t.Errorf("headers = %v", message.Header)
+	}
+	for _, expected := range []string{
+		"List: Spamhaus ZEN (zen.spamhaus.org)",
+		"Sub-lists: sbl",
+		"Reason: Listed in SBL",
+		"Delisting: https://check.spamhaus.org/",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("body does not contain %q:\n%s", expected, body)
+		}
+	}
+}
+
+func TestEmailImplicitTLS(t *testing.T) {
+	cert, caFile := testCertificate(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := startFakeSMTP(t, &fakeSMTP{}, listener)
+
+	email, err := configEmail{Smarthost: server.addr(), From: "dnsrbl@example.com", To: []string{"postmaster@example.com"}, TLS: "tls", CAFile: caFile}.toEmail()
+	if err != nil {
+		t.Fatalf("toEmail() error = %v", err)
+	}
+	if retry, err := sendMail(email, emailMessage(email, []Notification{testNotification(eventListed)}, time.Now())); err != nil {
+		t.Fatalf("sendMail() error = %v (retry %v)", err, retry)
+	}
+	if got := len(server.received()); got != 1 {
+		t.Errorf("received %d emails; want 1", got)
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	server := startFakeSMTP(t, &fakeSMTP{}, nil)
+	email := Email{Smarthost: server.addr(), From: "dnsrbl@example.com", To: []string{"postmaster@example.com"}, TLS: emailTLSStartTLS, Timeout: time.Second}
+
+	retry, err := sendMail(email, []byte("Subject: test\r\n\r\ntest\r\n"))
+	if err == nil || retry {
+		t.Errorf("sendMail() = %v, %v; want a permanent error", retry, err)
+	}
+	if got := len(server.received()); got != 0 {
+		t.Errorf("received %d emails without TLS", got)
+	}
+}
+
+func TestEmailRetries(t *testing.T) {
+	dnsrblNotifications.Reset()
+	defer dnsrblNotifications.Reset()
+
+	server := startFakeSMTP(t, &fakeSMTP{failures: 2}, nil)
+	email := Email{Smarthost: server.addr(), From: "dnsrbl@example.com", To: []string{"postmaster@example.com"}, TLS: emailTLSNone, Timeout: time.Second}
+	n := newNotifier(Notifications{Email: &email, Retries: 3, Backoff: time.Millisecond})
+
+	n.notify(testEvent(eventListed, time.Now()), testList)
+	n.wait()
+
+	if got := len(server.received()); got != 1 {
+		t.Errorf("received %d emails; want 1", got)
+	}
+	if got := testutil.ToFloat64(dnsrblNotifications.WithLabelValues("email", "sent")); got != 1 {
+		t.Errorf("dnsrbl_notifications_total{notifier=email,result=sent} = %v; want 1", got)
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	server := startFakeSMTP(t, &fakeSMTP{}, nil)
+	email := Email{Smarthost: server.addr(), From: "dnsrbl@example.com", To: []string{"a@example.com", "b@example.com"}, TLS: emailTLSNone, Digest: 50 * time.Millisecond, Timeout: time.Second}
+	n := newNotifier(Notifications{Email: &email, DedupWindow: time.Hour})
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	n.notify(testEvent(eventListed, start), testList)
+	n.notify(testEvent(eventListed, start.Add(time.Second)), testList) // duplicate
+	other := testEvent(eventDelisted, start.Add(2*time.Second))
+	other.Target = "192.0.2.2"
+	n.notify(other, testList)
+	n.wait()
+
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("received %d emails; want 1 digest", len(messages))
+	}
+	if len(messages[0].to) != 2 {
+		t.Errorf("recipients = %q", messages[0].to)
+	}
+
+	message, body := decodeMail(t, messages[0].data)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if subject != "[dnsrbl] 2 listing changes: 1 listed, 1 delisted" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if !strings.Contains(body, "192.0.2.1 is listed in Spamhaus ZEN") || !strings.Contains(body, "192.0.2.2 is no longer listed in Spamhaus ZEN") {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestConfigEmail(t *testing.T) {
+	valid := configEmail{Smarthost: "smtp.example.com:587", From: "dnsrbl@example.com", To: []string{"postmaster@example.com"}}
+
+	tests := []struct {
+		name    string
+		modify  func(*configEmail)
+		wantErr string
+	}{
+		{"valid", func(*configEmail) {}, ""},
+		{"digest", func(c *configEmail) { c.Digest = "15m" }, ""},
+		{"local relay without TLS", func(c *configEmail) { c.Smarthost, c.TLS, c.Username = "localhost:25", "none", "u" }, ""},
+		{"missing port", func(c *configEmail) { c.Smarthost = "smtp.example.com" }, "invalid smarthost"},
+		{"invalid from", func(c *configEmail) { c.From = "dnsrbl" }, "invalid from address"},
+		{"no recipients", func(c *configEmail) { c.To = nil }, "no recipients"},
+		{"invalid recipient", func(c *configEmail) { c.To = []string{"postmaster"} }, "invalid recipient"},
+		{"invalid tls", func(c *configEmail) { c.TLS = "ssl" }, "invalid tls mode"},
+		{"password without username", func(c *configEmail) { c.Password = "secret" }, "password without username"},
+		{"auth without TLS", func(c *configEmail) { c.TLS, c.Username = "none", "u" }, "authentication requires"},
+		{"invalid digest", func(c *configEmail) { c.Digest = "daily" }, "invalid digest"},
+		{"missing CA file", func(c *configEmail) { c.CAFile = "/non/existent/ca.pem" }, "CA file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := valid
+			test.modify(&config)
+			email, err := config.toEmail()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("toEmail() error = %v", err)
+				}
+				if email.TLS == "" || email.Timeout <= 0 {
+					t.Errorf("email = %+v", email)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("toEmail() error = %v; want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSMTPRetry(t *testing.T) {
+	if !smtpRetry(&textproto.Error{Code: 451, Msg: "try again"}) {
+		t.Error("4xx reply not retried")
+	}
+	if smtpRetry(&textproto.Error{Code: 550, Msg: "no such user"}) {
+		t.Error("5xx reply retried")
+	}
+	if !smtpRetry(io.ErrUnexpectedEOF) {
+		t.Error("connection error not retried")
+	}
+}
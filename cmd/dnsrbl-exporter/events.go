@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxEvents is the number of listing events kept in memory and in the state file
+const maxEvents = 1000
+
+// Types of listing events
+const (
+	eventListed   = "listed"
+	eventDelisted = "delisted"
+)
+
+// ListingEvent is a transition of a target between listed and not listed in a blacklist
+type ListingEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	List     string    `json:"list"`
+	Target   string    `json:"target"`
+	Module   string    `json:"module,omitempty"`
+	Sublists []string  `json:"sublists,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Duration float64   `json:"duration_seconds,omitempty"` // Time the target was listed, set on delisting
+	Initial  bool      `json:"initial,omitempty"`          // Listing found without an earlier result of the target and list, or its delisting
+}
+
+// eventLog tracks the current listings and keeps the latest listing events,
+// optionally persisted in a state file
+type eventLog struct {
+	mu      sync.RWMutex
+	events  []ListingEvent       // oldest first
+	since   map[string]time.Time // start of the current listings by list and target
+	known   map[string]bool      // list and target pairs with a listed or not listed result
+	initial map[string]bool      // current listings that were initial
+	limit   int
+	state   *stateStore
+}
+
+func newEventLog(limit int) *eventLog {
+	return &eventLog{
+		since:   make(map[string]time.Time),
+		known:   make(map[string]bool),
+		initial: make(map[string]bool),
+		limit:   limit,
+	}
+}
+
+var listingEvents = newEventLog(maxEvents)
+
+// persist writes all future events to a state file
+func (l *eventLog) persist(state *stateStore) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state = state
+}
+
+// observe records and returns an event if a check changes whether a target is
+// listed. Failed checks do not change it. A listing found without an earlier
+// result, e.g. after a start without state file, is marked as initial, like
+// the delisting ending it.
+func (l *eventLog) observe(job checkJob, result checkResult, checked time.Time) (ListingEvent, bool) {
+	target := job.Target.String()
+	key := reasonKey(job.List.Zone, target)
+	event := ListingEvent{Time: checked, List: job.List.Zone, Target: target, Module: job.Target.Module}
+
+	l.mu.Lock()
+	since, listed := l.since[key]
+	known := l.known[key]
+	if result.Result == "Found" || result.Result == "NXDOMAIN" {
+		l.known[key] = true
+	}
+	switch {
+	case result.Result == "Found" && !listed:
+		event.Type = eventListed
+		event.Initial = !known
+		event.Sublists = result.Sublists
+		event.Reason = result.Reason
+		l.since[key] = checked
+		if event.Initial {
+			l.initial[key] = true
+		}
+	case result.Result == "NXDOMAIN" && listed:
+		event.Type = eventDelisted
+		event.Duration = checked.Sub(since).Seconds()
+		event.Initial = l.initial[key]
+		delete(l.since, key)
+		delete(l.initial, key)
+	default:
+		l.mu.Unlock()
+		return ListingEvent{}, false
+	}
+	l.append(event)
+	state := l.state
+	l.mu.Unlock()
+
+	dnsrblListingEvents.WithLabelValues(event.List, event.Type).Inc()
+	if event.Type == eventListed {
+		dnsrblListedSince.With(pairLabels(event.List, target)).Set(float64(checked.Unix()))
+		log.Printf("Listing: %s found in %s", target, event.List)
+	} else {
+		dnsrblListedSince.Delete(pairLabels(event.List, target))
+		log.Printf("Delisting: %s removed from %s after %v", target, event.List, checked.Sub(since).Round(time.Second))
+	}
+
+	if state != nil {
+		if err := state.saveEvent(event, l.limit); err != nil {
+			log.Printf("Failed to save listing event of %s on %s: %v", target, event.List, err)
+		}
+	}
+	return event, true
+}
+
+// append adds an event, dropping the oldest events over the limit
+func (l *eventLog) append(event ListingEvent) {
+	l.events = append(l.events, event)
+	if len(l.events) > l.limit {
+		l.events = append([]ListingEvent(nil), l.events[len(l.events)-l.limit:]...)
+	}
+}
+
+// forget drops the current listing of a removed blacklist and target. Its
+// events stay in the history.
+func (l *eventLog) forget(blacklist, target string) {
+	key := reasonKey(blacklist, target)
+	l.mu.Lock()
+	_, listed := l.since[key]
+	delete(l.since, key)
+	delete(l.known, key)
+	delete(l.initial, key)
+	state := l.state
+	l.mu.Unlock()
+
+	dnsrblListedSince.Delete(pairLabels(blacklist, target))
+	if listed && state != nil {
+		if err := state.deleteListing(blacklist, target); err != nil {
+			log.Printf("Failed to delete listing of %s on %s: %v", target, blacklist, err)
+		}
+	}
+}
+
+// listedSince returns the start of the current listing of a target on a blacklist
+func (l *eventLog) listedSince(blacklist, target string) (time.Time, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	since, ok := l.since[reasonKey(blacklist, target)]
+	return since, ok
+}
+
+// filter returns the events matching a filter, newest first
+func (l *eventLog) filter(match func(ListingEvent) bool) []ListingEvent {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	events := make([]ListingEvent, 0)
+	for i := len(l.events) - 1; i >= 0; i-- {
+		if match(l.events[i]) {
+			events = append(events, l.events[i])
+		}
+	}
+	return events
+}
+
+// restoreEvents restores the stored events and the current listings of the
+// given pairs, which count as known like pairs with a stored result. Stored
+// listings of other pairs are dropped, their events are kept.
+func restoreEvents(state *stateStore, jobs []checkJob, events *eventLog) error {
+	stored, listings, err := state.loadEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load listing events: %w", err)
+	}
+	results, err := state.load()
+	if err != nil {
+		return fmt.Errorf("failed to load results: %w", err)
+	}
+	checked := make(map[string]bool, len(results))
+	for _, status := range results {
+		if status.Result == "Found" || status.Result == "NXDOMAIN" {
+			checked[reasonKey(status.List, status.Target)] = true
+		}
+	}
+
+	// Whether the latest listing of a pair was initial, the events are oldest first
+	initial := make(map[string]bool)
+	events.mu.Lock()
+	for _, event := range stored {
+		events.append(event)
+		if event.Type == eventListed {
+			initial[reasonKey(event.List, event.Target)] = event.Initial
+		}
+	}
+	for _, job := range jobs {
+		key := reasonKey(job.List.Zone, job.Target.String())
+		if checked[key] {
+			events.known[key] = true
+		}
+		if since, ok := listings[key]; ok {
+			events.known[key] = true
+			events.since[key] = since
+			if initial[key] {
+				events.initial[key] = true
+			}
+			dnsrblListedSince.With(pairLabels(job.List.Zone, job.Target.String())).Set(float64(since.Unix()))
+			delete(listings, key)
+		}
+	}
+	restored := len(events.since)
+	events.mu.Unlock()
+
+	for key := range listings {
+		list, target, _ := strings.Cut(key, "|")
+		if err := state.deleteListing(list, target); err != nil {
+			log.Printf("Failed to delete listing of %s on %s: %v", target, list, err)
+		}
+	}
+
+	log.Printf("Restored %d listing events and %d current listings from state file", len(stored), restored)
+	return nil
+}
+
+// eventsHandler serves the latest listing events at /api/v1/events, optionally
+// filtered by target, list and time
+func eventsHandler(events *eventLog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		target := params.Get("target")
+		if target != "" {
+			target = normalizeTarget(target)
+		}
+		zone := strings.TrimSuffix(strings.ToLower(params.Get("list")), ".")
+
+		var since time.Time
+		if value := params.Get("since"); value != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, value); err != nil {
+				writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid since " + strconv.Quote(value) + ", use RFC 3339"})
+				return
+			}
+		}
+		limit := 0
+		if value := params.Get("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+				writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid limit " + strconv.Quote(value)})
+				return
+			}
+		}
+
+		result := events.filter(func(event ListingEvent) bool {
+			return (target == "" || event.Target == target) &&
+				(zone == "" || event.List == zone) &&
+				!event.Time.Before(since)
+		})
+		if limit > 0 && len(result) > limit {
+			result = result[:limit]
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Events []ListingEvent `json:"events"`
+		}{result})
+	})
+}
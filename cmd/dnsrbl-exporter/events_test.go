@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func resetEventMetrics() {
+	dnsrblListedSince.Reset()
+	dnsrblListingEvents.Reset()
+}
+
+func TestEventLogObserve(t *testing.T) {
+	resetEventMetrics()
+	defer resetEventMetrics()
+
+	events := newEventLog(maxEvents)
+	job := checkJob{Target: Target{IP: "192.0.2.1", Module: "mail"}, List: List{Zone: "zen.spamhaus.org"}}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	checks := []struct {
+		result string
+		after  time.Duration
+	}{
+		{"NXDOMAIN", 0},
+		{"Found", time.Hour},
+		{"Found", 2 * time.Hour},
+		{"Timeout", 3 * time.Hour}, // failed checks do not end a listing
+		{"NXDOMAIN", 4 * time.Hour},
+		{"Found", 5 * time.Hour},
+	}
+	for _, check := range checks {
+		events.observe(job, checkResult{Result: check.result, Sublists: []string{"sbl"}}, start.Add(check.after))
+		if check.after == 2*time.Hour {
+			if got := testutil.ToFloat64(dnsrblListedSince.WithLabelValues(job.List.Zone, job.Target.IP, "")); got != float64(start.Add(time.Hour).Unix()) {
+				t.Errorf("dnsrbl_listed_since_timestamp_seconds = %v; want %v", got, start.Add(time.Hour).Unix())
+			}
+		}
+	}
+
+	all := events.filter(func(ListingEvent) bool { return true })
+	if len(all) != 3 {
+		t.Fatalf("got %d events; want %d", len(all), 3)
+	}
+
+	// Newest first
+	if all[0].Type != eventListed || !all[0].Time.Equal(start.Add(5*time.Hour)) {
+		t.Errorf("events[0] = %+v", all[0])
+	}
+	if all[1].Type != eventDelisted || all[1].Duration != (3*time.Hour).Seconds() || all[1].Module != "mail" {
+		t.Errorf("events[1] = %+v", all[1])
+	}
+	if all[2].Type != eventListed || len(all[2].Sublists) != 1 {
+		t.Errorf("events[2] = %+v", all[2])
+	}
+
+	if got := testutil.ToFloat64(dnsrblListingEvents.WithLabelValues(job.List.Zone, eventListed)); got != 2 {
+		t.Errorf("dnsrbl_listing_events_total{event=listed} = %v; want 2", got)
+	}
+	if got := testutil.ToFloat64(dnsrblListingEvents.WithLabelValues(job.List.Zone, eventDelisted)); got != 1 {
+		t.Errorf("dnsrbl_listing_events_total{event=delisted} = %v; want 1", got)
+	}
+	if got := testutil.ToFloat64(dnsrblListedSince.WithLabelValues(job.List.Zone, job.Target.IP, "")); got != float64(start.Add(5*time.Hour).Unix()) {
+		t.Errorf("dnsrbl_listed_since_timestamp_seconds = %v; want %v", got, start.Add(5*time.Hour).Unix())
+	}
+
+	events.forget(job.List.Zone, job.Target.IP)
+	if got := testutil.CollectAndCount(dnsrblListedSince); got != 0 {
+		t.Errorf("dnsrbl_listed_since_timestamp_seconds series = %d; want 0", got)
+	}
+	if got := len(events.filter(func(ListingEvent) bool { return true })); got != 3 {
+		t.Errorf("forget() dropped events, %d left", got)
+	}
+}
+
+func TestEventLogLimit(t *testing.T) {
+	resetEventMetrics()
+	defer resetEventMetrics()
+
+	events := newEventLog(2)
+	job := checkJob{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "bl.spamcop.net"}}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, result := range []string{"Found", "NXDOMAIN", "Found"} {
+		events.observe(job, checkResult{Result: result}, start.Add(time.Duration(i)*time.Hour))
+	}
+
+	all := events.filter(func(ListingEvent) bool { return true })
+	if len(all) != 2 || all[0].Type != eventListed || all[1].Type != eventDelisted {
+		t.Errorf("events = %+v", all)
+	}
+}
+
+func TestEventLogInitial(t *testing.T) {
+	resetEventMetrics()
+	defer resetEventMetrics()
+
+	events := newEventLog(maxEvents)
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	found := checkResult{Result: "Found", Sublists: []string{"pbl"}}
+	job := func(ip string) checkJob {
+		return checkJob{Target: Target{IP: ip}, List: List{Zone: "zen.spamhaus.org"}}
+	}
+
+	tests := []struct {
+		name    string
+		results []string
+		initial bool
+	}{
+		{"listed without earlier result", nil, true},
+		{"listed after failed checks", []string{"Timeout", "Refused"}, true},
+		{"listed after a clean result", []string{"NXDOMAIN"}, false},
+		{"listed after a clean result and a failed check", []string{"NXDOMAIN", "Timeout"}, false},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pair := job(fmt.Sprintf("192.0.2.%d", i+1))
+			for _, result := range test.results {
+				events.observe(pair, checkResult{Result: result}, start)
+			}
+			event, ok := events.observe(pair, found, start.Add(time.Hour))
+			if !ok || event.Type != eventListed || event.Initial != test.initial {
+				t.Errorf("observe() = %+v, %v; want listed with initial %v", event, ok, test.initial)
+			}
+		})
+	}
+
+	// The delisting of an initial listing is initial, a relisting is not
+	pair := job("192.0.2.1")
+	if event, ok := events.observe(pair, checkResult{Result: "NXDOMAIN"}, start.Add(2*time.Hour)); !ok || !event.Initial {
+		t.Errorf("delisting = %+v, %v; want an initial delisting", event, ok)
+	}
+	if event, ok := events.observe(pair, found, start.Add(3*time.Hour)); !ok || event.Initial {
+		t.Errorf("relisting = %+v, %v; want a listing that is not initial", event, ok)
+	}
+
+	// A removed pair is unknown again
+	events.forget("zen.spamhaus.org", "192.0.2.3")
+	if event, ok := events.observe(job("192.0.2.3"), found, start.Add(4*time.Hour)); !ok || !event.Initial {
+		t.Errorf("listing after removal = %+v, %v; want an initial listing", event, ok)
+	}
+}
+
+func TestRestoreEventsKnownResults(t *testing.T) {
+	resetEventMetrics()
+	defer resetEventMetrics()
+
+	state, _ := openTestStateStore(t)
+	clean := checkJob{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "zen.spamhaus.org"}}
+	failed := checkJob{Target: Target{IP: "192.0.2.2"}, List: List{Zone: "zen.spamhaus.org"}}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	state.save(CheckStatus{List: clean.List.Zone, Target: clean.Target.IP, Result: "NXDOMAIN", Checked: start})
+	state.save(CheckStatus{List: failed.List.Zone, Target: failed.Target.IP, Result: "Timeout", Checked: start})
+
+	events := newEventLog(maxEvents)
+	if err := restoreEvents(state, []checkJob{clean, failed}, events); err != nil {
+		t.Fatalf("restoreEvents() error = %v", err)
+	}
+	events.persist(state)
+
+	// A clean result before the restart makes a listing a transition
+	found := checkResult{Result: "Found", Sublists: []string{"sbl"}}
+	if event, ok := events.observe(clean, found, start.Add(time.Hour)); !ok || event.Initial {
+		t.Errorf("listing after a restored clean result = %+v, %v; want not initial", event, ok)
+	}
+	if event, ok := events.observe(failed, found, start.Add(time.Hour)); !ok || !event.Initial {
+		t.Errorf("listing after a restored failed result = %+v, %v; want initial", event, ok)
+	}
+
+	// The delisting of a restored initial listing is initial
+	restored := newEventLog(maxEvents)
+	if err := restoreEvents(state, []checkJob{clean, failed}, restored); err != nil {
+		t.Fatalf("restoreEvents() error = %v", err)
+	}
+	delisted := checkResult{Result: "NXDOMAIN"}
+	if event, ok := restored.observe(failed, delisted, start.Add(2*time.Hour)); !ok || !event.Initial {
+		t.Errorf("delisting of a restored initial listing = %+v, %v; want initial", event, ok)
+	}
+	if event, ok := restored.observe(clean, delisted, start.Add(2*time.Hour)); !ok || event.Initial {
+		t.Errorf("delisting of a restored listing = %+v, %v; want not initial", event, ok)
+	}
+}
+
+func TestRestoreEvents(t *testing.T) {
+	resetEventMetrics()
+	defer resetEventMetrics()
+
+	state, _ := openTestStateStore(t)
+	kept := checkJob{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "zen.spamhaus.org"}}
+	removed := checkJob{Target: Target{IP: "192.0.2.2"}, List: List{Zone: "zen.spamhaus.org"}}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	before := newEventLog(2)
+	before.persist(state)
+	before.observe(kept, checkResult{Result: "Found"}, start)
+	before.observe(removed, checkResult{Result: "Found"}, start.Add(time.Minute))
+	before.observe(removed, checkResult{Result: "NXDOMAIN"}, start.Add(time.Hour))
+	before.observe(removed, checkResult{Result: "Found"}, start.Add(2*time.Hour))
+	resetEventMetrics()
+
+	after := newEventLog(2)
+	if err := restoreEvents(state, []checkJob{kept}, after); err != nil {
+		t.Fatalf("restoreEvents() error = %v", err)
+	}
+
+	// The state file keeps the latest two events
+	all := after.filter(func(ListingEvent) bool { return true })
+	if len(all) != 2 || all[0].Type != eventListed || all[1].Type != eventDelisted || all[1].Target != removed.Target.IP {
+		t.Errorf("events = %+v", all)
+	}
+
+	if got := testutil.ToFloat64(dnsrblListedSince.WithLabelValues(kept.List.Zone, kept.Target.IP, "")); got != float64(start.Unix()) {
+		t.Errorf("dnsrbl_listed_since_timestamp_seconds = %v; want %v", got, start.Unix())
+	}
+	if got := testutil.CollectAndCount(dnsrblListedSince); got != 1 {
+		t.Errorf("dnsrbl_listed_since_timestamp_seconds series = %d; want 1", got)
+	}
+
+	// The restored listing continues, no new event
+	after.observe(kept, checkResult{Result: "Found"}, start.Add(3*time.Hour))
+	if got := len(after.filter(func(ListingEvent) bool { return true })); got != 2 {
+		t.Errorf("got %d events after a continued listing; want 2", got)
+	}
+
+	// The listing of the removed target is dropped from the file
+	_, listings, err := state.loadEvents()
+	if err != nil {
+		t.Fatalf("loadEvents() error = %v", err)
+	}
+	if len(listings) != 1 {
+		t.Errorf("state holds %d listings; want 1", len(listings))
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	resetEventMetrics()
+	defer resetEventMetrics()
+
+	events := newEventLog(maxEvents)
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	zen := List{Zone: "zen.spamhaus.org"}
+	spamcop := List{Zone: "bl.spamcop.net"}
+	events.observe(checkJob{Target: Target{IP: "192.0.2.1"}, List: zen}, checkResult{Result: "Found"}, start)
+	events.observe(checkJob{Target: Target{IP: "192.0.2.1"}, List: spamcop}, checkResult{Result: "Found"}, start.Add(time.Hour))
+	events.observe(checkJob{Target: Target{IP: "192.0.2.1"}, List: zen}, checkResult{Result: "NXDOMAIN"}, start.Add(2*time.Hour))
+	events.observe(checkJob{Target: Target{Domain: "example.com"}, List: List{Zone: "dbl.spamhaus.org"}}, checkResult{Result: "Found"}, start.Add(3*time.Hour))
+
+	tests := []struct {
+		query    string
+		status   int
+		expected int
+	}{
+		{"", http.StatusOK, 4},
+		{"?target=192.0.2.1", http.StatusOK, 3},
+		{"?target=Example.com.", http.StatusOK, 1},
+		{"?list=zen.spamhaus.org", http.StatusOK, 2},
+		{"?target=192.0.2.1&list=bl.spamcop.net", http.StatusOK, 1},
+		{"?since=2026-01-02T05:00:00Z", http.StatusOK, 2},
+		{"?limit=1", http.StatusOK, 1},
+		{"?target=192.0.2.9", http.StatusOK, 0},
+		{"?since=yesterday", http.StatusBadRequest, 0},
+		{"?limit=0", http.StatusBadRequest, 0},
+	}
+
+	handler := eventsHandler(events)
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/events"+test.query, nil))
+		if rec.Code != test.status {
+			t.Errorf("GET %s: status = %d; want %d", test.query, rec.Code, test.status)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		var body struct {
+			Events []ListingEvent `json:"events"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: invalid JSON: %v", test.query, err)
+		}
+		if body.Events == nil || len(body.Events) != test.expected {
+			t.Errorf("GET %s: %d events; want %d", test.query, len(body.Events), test.expected)
+		}
+	}
+}
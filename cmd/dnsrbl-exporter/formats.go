@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Formats of webhook bodies
+const (
+	formatJSON   = "json"   // the notification or the rendered template
+	formatSlack  = "slack"  // Slack incoming webhook message
+	formatTeams  = "teams"  // Microsoft Teams adaptive card
+	formatMatrix = "matrix" // Matrix room message sent through the client-server API
+)
+
+// endpoint returns the HTTP method and URL a notification is sent to
+func (w Webhook) endpoint(notification Notification) (string, string) {
+	if w.Format == formatMatrix {
+		// The notification ID as transaction ID makes retries idempotent
+		return http.MethodPut, strings.TrimSuffix(w.URL, "/") + "/_matrix/client/v3/rooms/" +
+			url.PathEscape(w.Room) + "/send/m.room.message/" + notification.ID
+	}
+	return http.MethodPost, w.URL
+}
+
+// payload renders the body of a notification in the format of the webhook
+func (w Webhook) payload(notification Notification) ([]byte, error) {
+	switch w.Format {
+	case formatSlack:
+		return json.Marshal(slackMessage(notification))
+	case formatTeams:
+		return json.Marshal(teamsMessage(notification))
+	case formatMatrix:
+		return json.Marshal(matrixMessage(notification))
+	default:
+		return renderPayload(w.Template, notification)
+	}
+}
+
+// fact is a named detail of a notification shown in chat messages
+type fact struct {
+	Name  string
+	Value string
+}
+
+// headline describes a notification by target and list name
+func (n Notification) headline() string {
+	if n.Type == eventDelisted {
+		return fmt.Sprintf("%s is no longer listed in %s", n.Target, n.ListName)
+	}
+	return fmt.Sprintf("%s is listed in %s", n.Target, n.ListName)
+}
+
+// title returns the headline of a notification in chat messages
+func (n Notification) title() string {
+	if n.Type == eventDelisted {
+		return "✅ " + n.headline()
+	}
+	return "🚨 " + n.headline()
+}
+
+// facts returns the details of a notification shown in chat messages and emails
+func (n Notification) facts() []fact {
+	list := n.List
+	if n.ListName != n.List {
+		list = n.ListName + " (" + n.List + ")"
+	}
+
+	facts := []fact{{"List", list}, {"Target", n.Target}}
+	if n.Module != "" {
+		facts = append(facts, fact{"Module", n.Module})
+	}
+	if len(n.Sublists) > 0 {
+		facts = append(facts, fact{"Sub-lists", strings.Join(n.Sublists, ", ")})
+	}
+	if n.Reason != "" {
+		facts = append(facts, fact{"Reason", n.Reason})
+	}
+	if n.Type == eventDelisted {
+		facts = append(facts, fact{"Listed for", time.Duration(n.Duration * float64(time.Second)).Round(time.Second).String()})
+	}
+	return append(facts, fact{"Time", n.Time.UTC().Format(time.RFC3339)})
+}
+
+// delistURL returns the delisting page linked in chat messages and emails, only for listings
+func (n Notification) delistURL() string {
+	if n.Type != eventListed {
+		return ""
+	}
+	return n.DelistURL
+}
+
+// slackMessage returns a Slack incoming webhook message using Block Kit
+func slackMessage(n Notification) map[string]any {
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+
+	var fields []map[string]any
+	for _, f := range n.facts() {
+		fields = append(fields, map[string]any{"type": "mrkdwn", "text": "*" + f.Name + "*\n" + escape(f.Value)})
+	}
+	blocks := []map[string]any{
+		{"type": "header", "text": map[string]any{"type": "plain_text", "text": n.title()}},
+		{"type": "section", "fields": fields},
+	}
+	if link := n.delistURL(); link != "" {
+		blocks = append(blocks, map[string]any{
+			"type": "actions",
+			"elements": []map[string]any{{
+				"type": "button",
+				"text": map[string]any{"type": "plain_text", "text": "Request delisting"},
+				"url":  link,
+			}},
+		})
+	}
+
+	// The text is shown in notifications and clients without Block Kit
+	return map[string]any{"text": n.title(), "blocks": blocks}
+}
+
+// teamsMessage returns a Microsoft Teams message with an adaptive card, as
+// accepted by Teams workflow webhooks
+func teamsMessage(n Notification) map[string]any {
+	color := "Attention"
+	if n.Type == eventDelisted {
+		color = "Good"
+	}
+
+	var facts []map[string]any
+	for _, f := range n.facts() {
+		facts = append(facts, map[string]any{"title": f.Name, "value": f.Value})
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []map[string]any{
+			{"type": "TextBlock", "text": n.title(), "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+			{"type": "FactSet", "facts": facts},
+		},
+	}
+	if link := n.delistURL(); link != "" {
+		card["actions"] = []map[string]any{{"type": "Action.OpenUrl", "title": "Request delisting", "url": link}}
+	}
+
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     card,
+		}},
+	}
+}
+
+// matrixMessage returns a Matrix m.room.message event with a plain text and
+// an HTML body
+func matrixMessage(n Notification) map[string]any {
+	text := []string{n.title()}
+	formatted := []string{"<strong>" + html.EscapeString(n.title()) + "</strong>"}
+	for _, f := range n.facts() {
+		text = append(text, f.Name+": "+f.Value)
+		formatted = append(formatted, "<b>"+html.EscapeString(f.Name)+":</b> "+html.EscapeString(f.Value))
+	}
+	if link := n.delistURL(); link != "" {
+		text = append(text, "Delisting: "+link)
+		formatted = append(formatted, `<a href="`+html.EscapeString(link)+`">Request delisting</a>`)
+	}
+
+	return map[string]any{
+		"msgtype":        "m.notice",
+		"body":           strings.Join(text, "\n"),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": strings.Join(formatted, "<br>"),
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNotification(eventType string) Notification {
+	event := testEvent(eventType, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	event.Reason = "Listed in SBL <https://check.spamhaus.org/sbl/query/SBL1> & more"
+	return newNotification(event, testList)
+}
+
+// renderFormat renders a notification in a format and decodes the JSON body
+func renderFormat(t *testing.T, format string, notification Notification) map[string]any {
+	t.Helper()
+	body, err := Webhook{Format: format}.payload(notification)
+	if err != nil {
+		t.Fatalf("payload() error = %v", err)
+	}
+	var message map[string]any
+	if err := json.Unmarshal(body, &message); err != nil {
+		t.Fatalf("invalid JSON %s: %v", body, err)
+	}
+	return message
+}
+
+func TestSlackMessage(t *testing.T) {
+	message := renderFormat(t, formatSlack, testNotification(eventListed))
+
+	if message["text"] != "🚨 192.0.2.1 is listed in Spamhaus ZEN" {
+		t.Errorf("text = %q", message["text"])
+	}
+	blocks := message["blocks"].([]any)
+	if len(blocks) != 3 {
+		t.Fatalf("got %d blocks; want 3", len(blocks))
+	}
+
+	var fields []string
+	for _, field := range blocks[1].(map[string]any)["fields"].([]any) {
+		fields = append(fields, field.(map[string]any)["text"].(string))
+	}
+	text := strings.Join(fields, "\n")
+	for _, expected := range []string{
+		"*List*\nSpamhaus ZEN (zen.spamhaus.org)",
+		"*Target*\n192.0.2.1",
+		"*Sub-lists*\nsbl",
+		"*Reason*\nListed in SBL &lt;https://check.spamhaus.org/sbl/query/SBL1&gt; &amp; more",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("fields %q do not contain %q", text, expected)
+		}
+	}
+
+	button := blocks[2].(map[string]any)["elements"].([]any)[0].(map[string]any)
+	if button["url"] != "https://check.spamhaus.org/" {
+		t.Errorf("button = %v", button)
+	}
+
+	// Delistings do not link to the delisting page
+	message = renderFormat(t, formatSlack, testNotification(eventDelisted))
+	if blocks := message["blocks"].([]any); len(blocks) != 2 {
+		t.Errorf("delisting has %d blocks; want 2", len(blocks))
+	}
+	if !strings.HasPrefix(message["text"].(string), "✅ 192.0.2.1 is no longer listed in Spamhaus ZEN") {
+		t.Errorf("text = %q", message["text"])
+	}
+}
+
+func TestTeamsMessage(t *testing.T) {
+	message := renderFormat(t, formatTeams, testNotification(eventListed))
+
+	attachment := message["attachments"].([]any)[0].(map[string]any)
+	if attachment["contentType"] != "application/vnd.microsoft.card.adaptive" {
+		t.Errorf("contentType = %q", attachment["contentType"])
+	}
+	card := attachment["content"].(map[string]any)
+	body := card["body"].([]any)
+	if title := body[0].(map[string]any); title["text"] != "🚨 192.0.2.1 is listed in Spamhaus ZEN" || title["color"] != "Attention" {
+		t.Errorf("title = %v", title)
+	}
+
+	facts := make(map[string]string)
+	for _, f := range body[1].(map[string]any)["facts"].([]any) {
+		facts[f.(map[string]any)["title"].(string)] = f.(map[string]any)["value"].(string)
+	}
+	if facts["Reason"] != "Listed in SBL <https://check.spamhaus.org/sbl/query/SBL1> & more" || facts["Sub-lists"] != "sbl" || facts["Time"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("facts = %v", facts)
+	}
+
+	action := card["actions"].([]any)[0].(map[string]any)
+	if action["type"] != "Action.OpenUrl" || action["url"] != "https://check.spamhaus.org/" {
+		t.Errorf("action = %v", action)
+	}
+
+	card = renderFormat(t, formatTeams, testNotification(eventDelisted))["attachments"].([]any)[0].(map[string]any)["content"].(map[string]any)
+	if _, ok := card["actions"]; ok {
+		t.Error("delisting links to the delisting page")
+	}
+}
+
+func TestMatrixMessage(t *testing.T) {
+	message := renderFormat(t, formatMatrix, testNotification(eventListed))
+
+	if message["msgtype"] != "m.notice" || message["format"] != "org.matrix.custom.html" {
+		t.Errorf("message = %v", message)
+	}
+	body := message["body"].(string)
+	if !strings.HasPrefix(body, "🚨 192.0.2.1 is listed in Spamhaus ZEN\nList: Spamhaus ZEN (zen.spamhaus.org)\n") ||
+		!strings.HasSuffix(body, "\nDelisting: https://check.spamhaus.org/") {
+		t.Errorf("body = %q", body)
+	}
+	formatted := message["formatted_body"].(string)
+	if !strings.Contains(formatted, "<b>Reason:</b> Listed in SBL &lt;https://check.spamhaus.org/sbl/query/SBL1&gt; &amp; more") ||
+		!strings.Contains(formatted, `<a href="https://check.spamhaus.org/">Request delisting</a>`) {
+		t.Errorf("formatted_body = %q", formatted)
+	}
+
+	body = renderFormat(t, formatMatrix, testNotification(eventDelisted))["body"].(string)
+	if !strings.Contains(body, "Listed for: 1h30m0s") || strings.Contains(body, "Delisting") {
+		t.Errorf("delisting body = %q", body)
+	}
+}
+
+func TestNotifierMatrix(t *testing.T) {
+	receiver, url := newTestReceiver(t)
+	webhook := Webhook{URL: strings.TrimSuffix(url, "/hooks/secret") + "/", Format: formatMatrix, Room: "!room:example.org", Token: "secret", Timeout: time.Second}
+	if err := webhook.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+	n := newNotifier(Notifications{Webhooks: []Webhook{webhook}})
+
+	notification := testNotification(eventListed)
+	n.notify(notification.ListingEvent, testList)
+	n.wait()
+
+	if len(receiver.requests) != 1 {
+		t.Fatalf("received %d requests; want 1", len(receiver.requests))
+	}
+	req := receiver.requests[0]
+	if req.Method != http.MethodPut {
+		t.Errorf("method = %s; want PUT", req.Method)
+	}
+	if expected := "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/" + notification.ID; req.URL.EscapedPath() != expected {
+		t.Errorf("path = %s; want %s", req.URL.EscapedPath(), expected)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q; want %q", got, "Bearer secret")
+	}
+}
+
+func TestWebhookValidateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook configWebhook
+		wantErr string
+	}{
+		{"slack", configWebhook{URL: "https://hooks.slack.com/services/T/B/X", Format: "slack"}, ""},
+		{"teams", configWebhook{URL: "https://example.webhook.office.com/x", Format: "teams"}, ""},
+		{"matrix", configWebhook{URL: "https://matrix.example.org", Format: "matrix", Room: "!a:example.org", Token: "t"}, ""},
+		{"unknown format", configWebhook{URL: "https://example.com/", Format: "discord"}, "unknown webhook format"},
+		{"matrix without room", configWebhook{URL: "https://matrix.example.org", Format: "matrix", Token: "t"}, "requires a room"},
+		{"room without matrix", configWebhook{URL: "https://example.com/", Room: "!a:example.org"}, "only supported"},
+		{"template with slack", configWebhook{URL: "https://example.com/", Format: "slack", Template: `{}`}, "only supported"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.webhook.toWebhook()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("toWebhook() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("toWebhook() error = %v; want %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// List types
+const (
+	listTypeIP     = "ip"
+	listTypeDomain = "domain"
+)
+
+// List describes a single blacklist zone, its capabilities and metadata
+type List struct {
+	Zone      string
+	Type      string
+	IPv4      bool
+	IPv6      bool
+	Resolvers []string
+
+	Name      string
+	Homepage  string
+	DelistURL string
+	Severity  float64 // Weight of a listing, 1 by default
+
+	// ReturnCodes decodes the answers of the list, the built-in table of
+	// well-known lists is used if empty
+	ReturnCodes returnCodes
+
+	// AccessKey is prefixed to queries of lists requiring an access key
+	AccessKey         string
+	AccessKeyRequired bool
+
+	// Authoritative queries the authoritative nameservers of the zone directly
+	Authoritative bool
+
+	// Interval between two checks of a target, the default interval is used if zero
+	Interval time.Duration
+}
+
+// parseList parses a list entry of the form "zone" or "zone:option,option".
+// Supported options are "ipv4", "ipv6", "domain", "authoritative",
+// "interval=duration" and "resolver=address", which may be given multiple
+// times. IP lists without address family options only support IPv4.
+func parseList(entry string) (List, error) {
+	zone, options, _ := strings.Cut(strings.TrimSpace(entry), ":")
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	if zone == "" {
+		return List{}, fmt.Errorf("invalid list entry %q: missing zone", entry)
+	}
+
+	list := List{Zone: zone, Type: listTypeIP, Severity: 1}
+	if options != "" {
+		for _, option := range strings.Split(options, ",") {
+			option = strings.TrimSpace(option)
+			if address, ok := strings.CutPrefix(option, "resolver="); ok {
+				if _, err := parseResolver(address); err != nil {
+					return List{}, fmt.Errorf("invalid list entry %q: %w", entry, err)
+				}
+				list.Resolvers = append(list.Resolvers, address)
+				continue
+			}
+			if value, ok := strings.CutPrefix(option, "interval="); ok {
+				interval, err := parseDuration(value)
+				if err != nil || interval <= 0 {
+					return List{}, fmt.Errorf("invalid list entry %q: invalid interval %q", entry, value)
+				}
+				list.Interval = interval
+				continue
+			}
+
+			switch option {
+			case "ipv4":
+				list.IPv4 = true
+			case "ipv6":
+				list.IPv6 = true
+			case "domain":
+				list.Type = listTypeDomain
+			case "authoritative":
+				list.Authoritative = true
+			default:
+				return List{}, fmt.Errorf("invalid list entry %q: unknown option %q", entry, option)
+			}
+		}
+	}
+
+	if list.Type == listTypeDomain {
+		if list.IPv4 || list.IPv6 {
+			return List{}, fmt.Errorf("invalid list entry %q: domain lists do not support address families", entry)
+		}
+	} else if !list.IPv4 && !list.IPv6 {
+		list.IPv4 = true
+	}
+
+	return list, nil
+}
+
+// parseLists parses list entries, skipping comments and empty lines
+func parseLists(entries []string) ([]List, error) {
+	var lists []List
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		list, err := parseList(entry)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
+// uniqueZones checks that no zone is configured twice, across inline lists
+// and list files
+func uniqueZones(lists []List) error {
+	seen := make(map[string]bool, len(lists))
+	for _, list := range lists {
+		if seen[list.Zone] {
+			return fmt.Errorf("duplicate list zone %s", list.Zone)
+		}
+		seen[list.Zone] = true
+	}
+	return nil
+}
+
+// returnCodes returns the return code table of the list
+func (l List) returnCodes() returnCodes {
+	if len(l.ReturnCodes.Codes) > 0 || len(l.ReturnCodes.Bitmask) > 0 || len(l.ReturnCodes.Refused) > 0 {
+		return l.ReturnCodes
+	}
+	return knownReturnCodes[l.Zone]
+}
+
+// displayName returns the name of the list, or its zone if it has none
+func (l List) displayName() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	return l.Zone
+}
+
+// supports reports whether the list can be queried for the given target
+func (l List) supports(target Target) bool {
+	if target.Domain != "" {
+		return l.Type == listTypeDomain
+	}
+	if strings.Contains(target.IP, ":") {
+		return l.IPv6
+	}
+	return l.IPv4
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name        string
+		entry       string
+		expected    List
+		shouldError bool
+	}{
+		{
+			name:     "plain zone",
+			entry:    "zen.spamhaus.org",
+			expected: List{Zone: "zen.spamhaus.org", Type: listTypeIP, Severity: 1, IPv4: true},
+		},
+		{
+			name:     "trailing dot and upper case",
+			entry:    "ZEN.Spamhaus.org.",
+			expected: List{Zone: "zen.spamhaus.org", Type: listTypeIP, Severity: 1, IPv4: true},
+		},
+		{
+			name:     "IPv4 and IPv6",
+			entry:    "zen.spamhaus.org:ipv4,ipv6",
+			expected: List{Zone: "zen.spamhaus.org", Type: listTypeIP, Severity: 1, IPv4: true, IPv6: true},
+		},
+		{
+			name:     "IPv6 only",
+			entry:    "v6.example.org:ipv6",
+			expected: List{Zone: "v6.example.org", Type: listTypeIP, Severity: 1, IPv6: true},
+		},
+		{
+			name:     "domain list",
+			entry:    "dbl.spamhaus.org:domain",
+			expected: List{Zone: "dbl.spamhaus.org", Type: listTypeDomain, Severity: 1},
+		},
+		{
+			name:     "resolver overrides",
+			entry:    "zen.dq.spamhaus.net:ipv4,ipv6,resolver=10.0.0.1,resolver=tcp://[2001:db8::1]:53",
+			expected: List{Zone: "zen.dq.spamhaus.net", Type: listTypeIP, Severity: 1, IPv4: true, IPv6: true, Resolvers: []string{"10.0.0.1", "tcp://[2001:db8::1]:53"}},
+		},
+		{
+			name:     "authoritative",
+			entry:    "bl.spamcop.net:authoritative",
+			expected: List{Zone: "bl.spamcop.net", Type: listTypeIP, Severity: 1, IPv4: true, Authoritative: true},
+		},
+		{
+			name:     "interval",
+			entry:    "zen.spamhaus.org:ipv4,interval=1h",
+			expected: List{Zone: "zen.spamhaus.org", Type: listTypeIP, Severity: 1, IPv4: true, Interval: time.Hour},
+		},
+		{
+			name:     "interval in seconds",
+			entry:    "zen.spamhaus.org:interval=3600",
+			expected: List{Zone: "zen.spamhaus.org", Type: listTypeIP, Severity: 1, IPv4: true, Interval: time.Hour},
+		},
+		{
+			name:        "invalid interval",
+			entry:       "zen.spamhaus.org:interval=daily",
+			shouldError: true,
+		},
+		{
+			name:        "invalid resolver",
+			entry:       "zen.spamhaus.org:resolver=quic://10.0.0.1",
+			shouldError: true,
+		},
+		{
+			name:        "domain list with address family",
+			entry:       "dbl.spamhaus.org:domain,ipv4",
+			shouldError: true,
+		},
+		{
+			name:        "unknown option",
+			entry:       "zen.spamhaus.org:ipv5",
+			shouldError: true,
+		},
+		{
+			name:        "missing zone",
+			entry:       ":ipv6",
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseList(tt.entry)
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("parseList(%q) expected error but got none", tt.entry)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseList(%q) unexpected error: %v", tt.entry, err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("parseList(%q) = %+v; want %+v", tt.entry, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseLists_SkipsComments(t *testing.T) {
+	lists, err := parseLists([]string{"# comment", "", "zen.spamhaus.org", "  bl.spamcop.net  "})
+	if err != nil {
+		t.Fatalf("parseLists() unexpected error: %v", err)
+	}
+	if len(lists) != 2 {
+		t.Fatalf("parseLists() returned %d lists; want %d", len(lists), 2)
+	}
+	if lists[0].Zone != "zen.spamhaus.org" || lists[1].Zone != "bl.spamcop.net" {
+		t.Errorf("parseLists() = %+v", lists)
+	}
+}
+
+func TestListSupports(t *testing.T) {
+	v4 := List{Zone: "v4.example.org", Type: listTypeIP, IPv4: true}
+	v6 := List{Zone: "v6.example.org", Type: listTypeIP, IPv6: true}
+	domain := List{Zone: "dbl.example.org", Type: listTypeDomain}
+
+	ipv4Target := Target{IP: "192.0.2.1"}
+	ipv6Target := Target{IP: "2001:db8::1"}
+	domainTarget := Target{Domain: "example.com"}
+
+	if !v4.supports(ipv4Target) {
+		t.Error("IPv4 list should support IPv4 addresses")
+	}
+	if v4.supports(ipv6Target) {
+		t.Error("IPv4 list should not support IPv6 addresses")
+	}
+	if v6.supports(ipv4Target) {
+		t.Error("IPv6 list should not support IPv4 addresses")
+	}
+	if !v6.supports(ipv6Target) {
+		t.Error("IPv6 list should support IPv6 addresses")
+	}
+	if v4.supports(domainTarget) {
+		t.Error("IP list should not support domains")
+	}
+	if !domain.supports(domainTarget) {
+		t.Error("domain list should support domains")
+	}
+	if domain.supports(ipv4Target) {
+		t.Error("domain list should not support IP addresses")
+	}
+}
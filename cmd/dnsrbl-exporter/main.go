@@ -9,10 +9,13 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -31,6 +34,7 @@ var (
 		"Timeout":         4,
 		"Unknown":         5,
 		"LifetimeTimeout": 4,
+		"Refused":         6,
 	}
 
 	// Prometheus metrics
@@ -42,11 +46,20 @@ var (
 		[]string{"check_ip", "check_ip_mode", "delay_between_requests", "delay_between_runs"},
 	)
 
-	dnsrblTaskState = promauto.NewGauge(
+	dnsrblTaskState = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "dnsrbl_task_state",
 			Help: "Task state: 0=sleeping, 1=running",
 		},
+		[]string{"ip"},
+	)
+
+	dnsrblLastRun = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_last_run_timestamp_seconds",
+			Help: "Unix timestamp of the last completed check cycle",
+		},
+		[]string{"ip"},
 	)
 
 	dnsrblListSize = promauto.NewGauge(
@@ -56,6 +69,22 @@ var (
 		},
 	)
 
+	dnsrblListInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_list_info",
+			Help: "Metadata of a blacklist",
+		},
+		[]string{"list", "name", "type", "homepage", "delist_url"},
+	)
+
+	dnsrblListSeverity = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_list_severity",
+			Help: "Severity weight of a blacklist",
+		},
+		[]string{"list"},
+	)
+
 	dnsrblQuery = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "dnsrbl_query",
@@ -67,11 +96,75 @@ var (
 	dnsrblStatus = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "dnsrbl_status",
-			Help: "DNSRBL check status: 0=ok, 1=found in blacklist, 2-5=error",
+			Help: "DNSRBL check status: 0=ok, 1=found in blacklist, 2-5=error, 6=refused by blacklist",
 		},
 		[]string{"list", "ip"},
 	)
 
+	dnsrblDomainQuery = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dnsrbl_domain_query",
+			Help: "DNS queries for domains",
+		},
+		[]string{"list", "domain", "result"},
+	)
+
+	dnsrblDomainStatus = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_domain_status",
+			Help: "Domain blacklist check status: 0=ok, 1=found in blacklist, 2-5=error, 6=refused by blacklist",
+		},
+		[]string{"list", "domain"},
+	)
+
+	dnsrblListed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_listed",
+			Help: "Sub-lists of a blacklist an IP is found in",
+		},
+		[]string{"list", "ip", "sublist"},
+	)
+
+	dnsrblDomainListed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_domain_listed",
+			Help: "Sub-lists of a blacklist a domain is found in",
+		},
+		[]string{"list", "domain", "sublist"},
+	)
+
+	dnsrblListingReason = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_listing_reason_info",
+			Help: "Listing reason published by a blacklist as TXT record",
+		},
+		[]string{"list", "ip", "reason"},
+	)
+
+	dnsrblDomainListingReason = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_domain_listing_reason_info",
+			Help: "Domain listing reason published by a blacklist as TXT record",
+		},
+		[]string{"list", "domain", "reason"},
+	)
+
+	dnsrblCIDRListed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_cidr_listed",
+			Help: "Number of addresses in a CIDR range found in a blacklist",
+		},
+		[]string{"list", "cidr"},
+	)
+
+	dnsrblCIDRSize = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_cidr_size",
+			Help: "Number of addresses checked in a CIDR range",
+		},
+		[]string{"cidr"},
+	)
+
 	httpblLastActivity = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "httpbl_last_activity",
@@ -96,6 +189,67 @@ var (
 		[]string{"list", "ip"},
 	)
 
+	dnsrblRunDuration = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_run_duration_seconds",
+			Help: "Duration of the last batch of due checks",
+		},
+	)
+
+	dnsrblNextCheck = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_next_check_timestamp_seconds",
+			Help: "Unix timestamp of the next scheduled check of a target against a blacklist",
+		},
+		[]string{"list", "ip", "domain"},
+	)
+
+	dnsrblLastCheck = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_last_check_timestamp_seconds",
+			Help: "Unix timestamp of the last check of a target against a blacklist, including checks before a restart",
+		},
+		[]string{"list", "ip", "domain"},
+	)
+
+	dnsrblListedSince = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_listed_since_timestamp_seconds",
+			Help: "Unix timestamp of the check that first found a currently listed target in a blacklist",
+		},
+		[]string{"list", "ip", "domain"},
+	)
+
+	dnsrblListingEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dnsrbl_listing_events_total",
+			Help: "Number of listings and delistings of targets by blacklist",
+		},
+		[]string{"list", "event"},
+	)
+
+	dnsrblNotifications = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dnsrbl_notifications_total",
+			Help: "Number of listing event notifications by notifier and result (sent, failed, suppressed)",
+		},
+		[]string{"notifier", "result"},
+	)
+
+	dnsrblConfigLastReloadSuccessful = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_config_last_reload_successful",
+			Help: "Whether the last configuration reload attempt was successful",
+		},
+	)
+
+	dnsrblConfigLastReloadSuccess = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "dnsrbl_config_last_reload_success_timestamp_seconds",
+			Help: "Unix timestamp of the last successful configuration reload",
+		},
+	)
+
 	requestDuration = promauto.NewSummary(
 		prometheus.SummaryOpts{
 			Name: "request_processing_seconds",
@@ -104,20 +258,42 @@ var (
 	)
 )
 
+// pairLabels returns the labels of a target and blacklist pair, with the
+// target as ip or domain label like in the status metrics
+func pairLabels(blacklist, target string) prometheus.Labels {
+	if _, err := netip.ParseAddr(target); err == nil {
+		return prometheus.Labels{"list": blacklist, "ip": target, "domain": ""}
+	}
+	return prometheus.Labels{"list": blacklist, "ip": "", "domain": target}
+}
+
 // Config holds the application configuration
 type Config struct {
-	CheckIP              string
-	CheckIPMode          string
-	DelayBetweenRequests time.Duration
-	DelayBetweenRuns     time.Duration
-	Port                 int
-	Lists                []string
-	HTTPBLAccessKey      string
+	CheckIPs                 []string
+	CheckIPMode              string
+	CheckDomains             []string
+	MaxCIDRSize              int
+	Targets                  []Target
+	DelayBetweenRequests     time.Duration
+	DelayBetweenRuns         time.Duration
+	DelayBetweenListRequests time.Duration
+	Concurrency              int
+	Jitter                   int
+	ListenAddress            string
+	Lists                    []List
+	Modules                  map[string]Module
+	Resolvers                []string
+	ResolverMode             string
+	HTTPBLAccessKey          string
+	StateFile                string
+	Notifications            Notifications
+	Files                    []string
 }
 
 func main() {
 	// Parse command-line flags
 	versionFlag := flag.Bool("version", false, "Print version and exit")
+	configFlag := flag.String("config", os.Getenv("DNSRBL_CONFIG"), "Path to the YAML configuration file")
 	flag.Parse()
 
 	if *versionFlag {
@@ -125,93 +301,379 @@ func main() {
 		os.Exit(0)
 	}
 
-	config := loadConfig()
+	config, err := loadConfig(*configFlag)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cidrs := newCIDRTracker()
+
+	resolvers, err := newResolverSet(config)
+	if err != nil {
+		log.Fatalf("Failed to create resolvers: %v", err)
+	}
+	pool := newCheckPool(config.Concurrency, config.DelayBetweenRequests, config.DelayBetweenListRequests)
+
+	// Keep the latest results across restarts
+	var state *stateStore
+	if config.StateFile != "" {
+		state, err = openStateStore(config.StateFile)
+		if err != nil {
+			log.Fatalf("Failed to open state: %v", err)
+		}
+		defer state.close()
+		checkResults.persist(state)
+		listingEvents.persist(state)
+	}
+	pendingRestore := state
+	eventNotifier.update(config.Notifications)
+	listingAlerts.update(config)
+	go listingAlerts.run()
 
 	// Start Prometheus HTTP server
 	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/api/v1/reasons", reasonsHandler(listingReasons))
+	http.Handle("GET /api/v1/status", statusHandler(checkResults))
+	http.Handle("GET /api/v1/targets/{target}", targetHandler(checkResults))
+	http.Handle("GET /api/v1/lists/{zone}", listHandler(checkResults))
+	http.Handle("GET /api/v1/events", eventsHandler(listingEvents))
+	probes := newProber(config, resolvers, pool)
+	http.Handle("/probe", probes)
+	statusPage := newDashboard(config, checkResults)
+	http.Handle("GET /{$}", statusPage)
+	listenAddress, stateFile := config.ListenAddress, config.StateFile
 	go func() {
-		addr := fmt.Sprintf(":%d", config.Port)
-		log.Printf("Starting HTTP server on %s", addr)
-		if err := http.ListenAndServe(addr, nil); err != nil {
+		log.Printf("Starting HTTP server on %s", listenAddress)
+		if err := http.ListenAndServe(listenAddress, nil); err != nil {
 			log.Fatalf("Failed to start HTTP server: %v", err)
 		}
 	}()
 
-	// Main loop
+	// Reload the configuration on SIGHUP or when one of its files changes
+	dnsrblConfigLastReloadSuccessful.Set(1)
+	dnsrblConfigLastReloadSuccess.SetToCurrentTime()
+	watcher := newConfigWatcher(config.Files)
+	reloads := make(chan string, 1)
+	go watchReloads(watcher, reloads)
+
+	// Main loop. Checks run in the background, so that reloads are handled
+	// while they run.
+	sched := newScheduler(config.DelayBetweenRuns, config.Jitter)
+	var nextTargetUpdate time.Time
+	var lists []List            // lists of the last target update
+	var running <-chan struct{} // closed when the running checks are done, nil if none
+	var cancelChecks func()     // cancels the running checks
 	for {
-		checkIP := config.CheckIP
-		if config.CheckIPMode == "dynamic" {
-			var err error
-			checkIP, err = getExternalIP()
+		if running == nil {
+			if now := time.Now(); !now.Before(nextTargetUpdate) {
+				jobs := updateTargets(config, lists, sched, cidrs)
+				lists = config.Lists
+				nextTargetUpdate = now.Add(config.DelayBetweenRuns)
+
+				// Restore the results of the first known targets until they are checked again
+				if pendingRestore != nil && jobs != nil {
+					if err := restoreState(pendingRestore, jobs, checkResults, cidrs); err != nil {
+						log.Printf("Failed to restore state: %v", err)
+					}
+					if err := restoreEvents(pendingRestore, jobs, listingEvents); err != nil {
+						log.Printf("Failed to restore listing events: %v", err)
+					}
+					pendingRestore = nil
+					listingAlerts.trigger()
+				}
+			}
+
+			if jobs := sched.due(time.Now()); len(jobs) > 0 {
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan struct{})
+				go func(config *Config, pool *checkPool, resolvers *resolverSet) {
+					defer close(done)
+					runChecks(ctx, jobs, config, sched, pool, cidrs, resolvers)
+				}(config, pool, resolvers)
+				running, cancelChecks = done, cancel
+			}
+		}
+
+		// Wait for the running checks, or the next due check or target update
+		var wake <-chan time.Time
+		if running == nil {
+			next := sched.next()
+			if next.IsZero() || next.After(nextTargetUpdate) {
+				next = nextTargetUpdate
+			}
+			delay := time.Until(next)
+			if delay <= 0 {
+				continue
+			}
+			log.Printf("Sleeping for %v...", delay.Round(time.Millisecond))
+			wake = time.After(delay)
+		}
+
+		select {
+		case <-wake:
+		case <-running:
+			running = nil
+			cancelChecks()
+		case reason := <-reloads:
+			log.Printf("Reloading configuration after %s", reason)
+			newConfig, newResolvers, err := reloadConfig(*configFlag)
 			if err != nil {
-				log.Printf("Error getting external IP: %v", err)
-				time.Sleep(config.DelayBetweenRuns)
+				log.Printf("Failed to reload configuration: %v", err)
+				dnsrblConfigLastReloadSuccessful.Set(0)
 				continue
 			}
+			if newConfig.ListenAddress != listenAddress {
+				log.Printf("Changing the listen address requires a restart, still listening on %s", listenAddress)
+			}
+			if newConfig.StateFile != stateFile {
+				log.Printf("Changing the state file requires a restart, still using %q", stateFile)
+			}
+
+			// Checks not started yet run again with the new configuration
+			if running != nil {
+				log.Printf("Stopping the running checks")
+				cancelChecks()
+				<-running
+				running = nil
+			}
+
+			config, resolvers = newConfig, newResolvers
+			pool = newCheckPool(config.Concurrency, config.DelayBetweenRequests, config.DelayBetweenListRequests)
+			sched.configure(config.DelayBetweenRuns, config.Jitter)
+			probes.update(config, resolvers, pool)
+			statusPage.update(config)
+			eventNotifier.update(config.Notifications)
+			listingAlerts.update(config)
+			watcher.watch(config.Files)
+			nextTargetUpdate = time.Time{}
+			dnsrblConfigLastReloadSuccessful.Set(1)
+			dnsrblConfigLastReloadSuccess.SetToCurrentTime()
+		}
+	}
+}
+
+// updateTargets schedules the configured targets, or the external IP in
+// dynamic mode, against all configured blacklists. The series of previous
+// lists missing from the configuration are deleted. It returns the scheduled
+// checks, nil if the external IP is unknown.
+func updateTargets(config *Config, previous []List, sched *scheduler, cidrs *cidrTracker) []checkJob {
+	log.Printf("Using %d blacklists", len(config.Lists))
+	// After the series of removed pairs, which may update CIDR series of removed lists
+	defer updateLists(config.Lists, previous)
+
+	targets := config.Targets
+	if config.CheckIPMode == "dynamic" {
+		checkIP, err := getExternalIP()
+		if err != nil {
+			log.Printf("Error getting external IP: %v", err)
+			return nil
 		}
+		targets = []Target{{IP: checkIP}}
+	}
 
-		log.Printf("Using %s as %s check IP", checkIP, config.CheckIPMode)
-		dnsrblListSize.Set(float64(len(config.Lists)))
-		log.Printf("Using %d blacklists", len(config.Lists))
+	log.Printf("Using %d %s check targets", len(targets), config.CheckIPMode)
+
+	dnsrblInfo.Reset()
+	cidrSizes := make(map[string]int)
+	for _, target := range targets {
+		if target.Domain != "" {
+			continue
+		}
 
 		// Set info metric
 		dnsrblInfo.WithLabelValues(
-			checkIP,
+			target.IP,
 			config.CheckIPMode,
 			fmt.Sprintf("%ds", int(config.DelayBetweenRequests.Seconds())),
 			fmt.Sprintf("%ds", int(config.DelayBetweenRuns.Seconds())),
 		).Set(1)
 
-		for _, blacklist := range config.Lists {
-			if strings.HasPrefix(blacklist, "#") || strings.TrimSpace(blacklist) == "" {
-				continue
+		if target.CIDR != "" {
+			cidrSizes[target.CIDR]++
+		}
+	}
+	for cidr, size := range cidrSizes {
+		dnsrblCIDRSize.WithLabelValues(cidr).Set(float64(size))
+	}
+
+	jobs := checkJobs(targets, config.Lists, config.Modules)
+	removed := sched.update(jobs, time.Now())
+	deleteSeries(removed, targets, cidrs)
+	return jobs
+}
+
+// runChecks runs due checks and reschedules them. Checks not started when the
+// context is canceled stay due.
+func runChecks(ctx context.Context, jobs []checkJob, config *Config, sched *scheduler, pool *checkPool, cidrs *cidrTracker, resolvers *resolverSet) {
+	start := time.Now()
+
+	remaining := make(map[string]int)
+	for _, job := range jobs {
+		remaining[job.Target.String()]++
+		dnsrblTaskState.WithLabelValues(job.Target.String()).Set(1) // running
+	}
+
+	var mu sync.Mutex
+	checked := make(map[string]bool, len(jobs))
+	pool.run(ctx, jobs, func(job checkJob) {
+		var result checkResult
+		if job.Target.Domain != "" {
+			result = checkDomain(resolvers.forList(job.List), job.Target.Domain, job.List)
+		} else {
+			result = checkDNSRBL(resolvers.forList(job.List), job.Target.IP, job.List)
+		}
+
+		if result.Result != "" {
+			if result.Result == "Found" || result.Result == "NXDOMAIN" {
+				// Failed checks do not end a listing, like in the listing events
+				cidrs.update(job.Target, job.List.Zone, result.Result == "Found")
 			}
+			checked := time.Now()
+			checkResults.set(job, result, checked)
+			if event, ok := listingEvents.observe(job, result, checked); ok {
+				eventNotifier.notify(event, job.List)
+				listingAlerts.trigger()
+			}
+			dnsrblLastCheck.With(pairLabels(job.List.Zone, job.Target.String())).Set(float64(checked.Unix()))
+		}
 
-			dnsrblTaskState.Set(1) // running
-			checkDNSRBL(checkIP, blacklist, config.HTTPBLAccessKey)
-			dnsrblTaskState.Set(0) // sleeping
+		next := sched.done(job, time.Now())
+		if !next.IsZero() {
+			dnsrblNextCheck.With(pairLabels(job.List.Zone, job.Target.String())).Set(float64(next.Unix()))
+		}
 
-			log.Printf("Sleeping for %v...", config.DelayBetweenRequests)
-			time.Sleep(config.DelayBetweenRequests)
+		mu.Lock()
+		defer mu.Unlock()
+		checked[scheduleKey(job)] = true
+		remaining[job.Target.String()]--
+		if remaining[job.Target.String()] == 0 {
+			dnsrblTaskState.WithLabelValues(job.Target.String()).Set(0) // sleeping
+			dnsrblLastRun.WithLabelValues(job.Target.String()).SetToCurrentTime()
 		}
+	})
 
-		log.Printf("Sleeping for %v...", config.DelayBetweenRuns)
-		time.Sleep(config.DelayBetweenRuns)
+	if ctx.Err() != nil {
+		for _, job := range jobs {
+			if !checked[scheduleKey(job)] {
+				sched.release(job)
+			}
+		}
+		for target, count := range remaining {
+			if count > 0 {
+				dnsrblTaskState.WithLabelValues(target).Set(0) // sleeping
+			}
+		}
+		log.Printf("Stopped after %d of %d checks in %v", len(checked), len(jobs), time.Since(start))
+		return
 	}
+
+	dnsrblRunDuration.Set(time.Since(start).Seconds())
+	log.Printf("Ran %d checks in %v", len(jobs), time.Since(start))
 }
 
-func loadConfig() *Config {
+func loadConfig(filename string) (*Config, error) {
 	config := &Config{
-		DelayBetweenRequests: time.Duration(getEnvAsInt("DNSRBL_DELAY_REQUESTS", 1)) * time.Second,
-		DelayBetweenRuns:     time.Duration(getEnvAsInt("DNSRBL_DELAY_RUNS", 60)) * time.Second,
-		Port:                 getEnvAsInt("DNSRBL_PORT", 8000),
-		HTTPBLAccessKey:      os.Getenv("DNSRBL_HTTP_BL_ACCESS_KEY"),
+		DelayBetweenRequests: 1 * time.Second,
+		DelayBetweenRuns:     60 * time.Second,
+		Concurrency:          1,
+		Jitter:               10,
+		ListenAddress:        ":8000",
+		MaxCIDRSize:          256,
+		ResolverMode:         resolverModeRecursive,
+		Notifications: Notifications{
+			Retries:       defaultNotificationRetries,
+			Backoff:       defaultNotificationBackoff,
+			DedupWindow:   defaultDedupWindow,
+			NotifyInitial: true,
+		},
+	}
+
+	// Apply the configuration file, environment variables take precedence
+	var file *configFile
+	if filename != "" {
+		config.Files = append(config.Files, filename)
+		var err error
+		if file, err = readConfigFile(filename); err != nil {
+			return nil, err
+		}
+		if err := file.apply(config); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	if err := applyEnv(config); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
 	}
 
-	// Determine check IP mode
-	if checkIP := os.Getenv("DNSRBL_CHECK_IP"); checkIP != "" {
-		config.CheckIP = checkIP
+	// Expand check targets and determine check IP mode
+	var err error
+	config.Targets, err = expandTargets(config.CheckIPs, config.MaxCIDRSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand check IPs: %w", err)
+	}
+	domains, err := domainTargets(config.CheckDomains)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse check domains: %w", err)
+	}
+	config.Targets = append(config.Targets, domains...)
+
+	if len(config.Targets) > 0 {
 		config.CheckIPMode = "static"
 	} else {
 		config.CheckIPMode = "dynamic"
 	}
 
-	// Load blacklist lists
-	if lists := os.Getenv("DNSRBL_LISTS"); lists != "" {
-		config.Lists = strings.Fields(lists)
-	} else {
-		filename := os.Getenv("DNSRBL_LISTS_FILENAME")
-		if filename == "" {
-			filename = "lists.txt"
+	// Fall back to the lists file of the working directory
+	if len(config.Lists) == 0 {
+		config.Files = append(config.Files, "lists.txt")
+		if config.Lists, err = readLists("lists.txt"); err != nil {
+			return nil, fmt.Errorf("failed to read lists: %w", err)
 		}
-		var err error
-		config.Lists, err = readListsFromFile(filename)
-		if err != nil {
-			log.Fatalf("Failed to read lists file: %v", err)
+	}
+	if err := uniqueZones(config.Lists); err != nil {
+		return nil, err
+	}
+
+	// Load modules once all lists are known
+	if file != nil && len(file.Modules) > 0 {
+		config.Modules = make(map[string]Module, len(file.Modules))
+		for name, entry := range file.Modules {
+			module, err := entry.toModule(name, config.Lists)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+			config.Modules[name] = module
+		}
+	}
+	for _, target := range config.Targets {
+		if _, err := moduleLists(config.Lists, config.Modules, target.Module); err != nil {
+			return nil, fmt.Errorf("check target %s: %w", target, err)
 		}
 	}
 
-	return config
+	// ProjectHoneyPot.org requires an access key configured by env
+	for i, list := range config.Lists {
+		if list.Zone == "dnsbl.httpbl.org" && !list.AccessKeyRequired {
+			config.Lists[i].AccessKeyRequired = true
+			config.Lists[i].AccessKey = config.HTTPBLAccessKey
+		}
+	}
+
+	return config, nil
+}
+
+// readLists reads lists from a structured catalogue or from a plain text file
+func readLists(filename string) ([]List, error) {
+	if isCatalogueFile(filename) {
+		return readCatalogue(filename)
+	}
+
+	entries, err := readListsFromFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseLists(entries)
 }
 
 func readListsFromFile(filename string) ([]string, error) {
@@ -237,107 +699,119 @@ func readListsFromFile(filename string) ([]string, error) {
 	return lists, nil
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return intVal
-		}
+// readEntries reads a whitespace or comma separated list from an environment
+// variable, or from the file named by a second environment variable
+func readEntries(envKey, filenameKey string) ([]string, string, error) {
+	if value := os.Getenv(envKey); value != "" {
+		return splitList(value), "", nil
 	}
-	return defaultValue
-}
 
-func checkDNSRBL(ip, blacklist, httpblAccessKey string) {
-	start := time.Now()
-	defer func() {
-		requestDuration.Observe(time.Since(start).Seconds())
-	}()
+	filename := os.Getenv(filenameKey)
+	if filename == "" {
+		return nil, "", nil
+	}
+	entries, err := readEntriesFromFile(filename)
+	return entries, filename, err
+}
 
-	reverseIP := convertToReverseIP(ip)
-	query := fmt.Sprintf("%s.%s.", reverseIP, blacklist)
+// readEntriesFromFile reads space or comma separated entries from a file, skipping comments
+func readEntriesFromFile(filename string) ([]string, error) {
+	lines, err := readListsFromFile(filename)
+	if err != nil {
+		return nil, err
+	}
 
-	if blacklist == "dnsbl.httpbl.org" {
-		if httpblAccessKey == "" {
-			log.Printf("Skipping blacklist %s due to missing env DNSRBL_HTTP_BL_ACCESS_KEY", blacklist)
-			return
+	entries := []string{}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			entries = append(entries, splitList(line)...)
 		}
-		query = fmt.Sprintf("%s.%s.%s.", httpblAccessKey, reverseIP, blacklist)
 	}
+	return entries, nil
+}
 
-	log.Printf("Checking %s.%s.", reverseIP, blacklist)
+// splitList splits a whitespace or comma separated string into its fields
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
 
+// checkDNSRBL checks an IP against a blacklist and returns the query result,
+// with an empty result type if the check was skipped for a missing access key
+func checkDNSRBL(resolver lookupResolver, ip string, list List) checkResult {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	answers, err := lookupIP(ctx, query)
-	if err != nil {
-		handleDNSError(err, blacklist, ip)
-		return
-	}
-
-	if len(answers) == 0 {
-		dnsrblQuery.WithLabelValues(blacklist, ip, "NoAnswer").Inc()
-		dnsrblStatus.WithLabelValues(blacklist, ip).Set(errorMapping["NoAnswer"])
-		log.Printf("Error: NoAnswer")
-		return
+	result := queryList(ctx, resolver, Target{IP: ip}, list)
+	if result.Result != "" {
+		requestDuration.Observe(result.Duration.Seconds())
+		ipResultMetrics.record(list.Zone, ip, result)
 	}
+	return result
+}
 
-	for _, answer := range answers {
-		result := answer.String()
-		log.Printf("Match: %s found in %s", result, blacklist)
-
-		if blacklist == "dnsbl.httpbl.org" {
-			parts := strings.Split(result, ".")
-			if len(parts) >= 4 {
-				lastActivity, _ := strconv.ParseFloat(parts[1], 64)
-				threatScore, _ := strconv.ParseFloat(parts[2], 64)
-				visitorType, _ := strconv.ParseFloat(parts[3], 64)
-
-				httpblLastActivity.WithLabelValues(blacklist, ip).Set(lastActivity)
-				httpblThreatScore.WithLabelValues(blacklist, ip).Set(threatScore)
-				httpblVisitorType.WithLabelValues(blacklist, ip).Set(visitorType)
-
-				log.Printf("Last activity: %s days ago", parts[1])
-				log.Printf("Threat score: %s", parts[2])
-				log.Printf("Visitor type: %s", parts[3])
-			}
-		}
+// lookupReason returns the listing reason a blacklist publishes as TXT record,
+// or an empty string if there is none
+func lookupReason(ctx context.Context, resolver lookupResolver, query string) string {
+	records, err := resolver.lookupTXT(ctx, query)
+	if err != nil {
+		log.Printf("No listing reason available: %v", err)
+		return ""
 	}
 
-	dnsrblQuery.WithLabelValues(blacklist, ip, "Found").Inc()
-	dnsrblStatus.WithLabelValues(blacklist, ip).Set(errorMapping["Found"])
+	reason := strings.Join(records, " ")
+	log.Printf("Reason: %s", reason)
+	return reason
 }
 
-func lookupIP(ctx context.Context, query string) ([]net.IP, error) {
-	resolver := &net.Resolver{}
-	return resolver.LookupIP(ctx, "ip4", strings.TrimSuffix(query, "."))
-}
-
-func handleDNSError(err error, blacklist, ip string) {
-	var errorType string
-
+// classifyDNSError maps a lookup error to an error type of errorMapping
+func classifyDNSError(err error) string {
 	if dnsErr, ok := err.(*net.DNSError); ok {
 		if dnsErr.IsNotFound {
-			errorType = "NXDOMAIN"
+			return "NXDOMAIN"
 		} else if dnsErr.IsTimeout {
-			errorType = "Timeout"
-		} else {
-			errorType = "Unknown"
+			return "Timeout"
 		}
-	} else {
-		errorType = "Unknown"
 	}
+	return "Unknown"
+}
 
-	log.Printf("Error: %s", errorType)
-	dnsrblQuery.WithLabelValues(blacklist, ip, errorType).Inc()
+// statusValue returns the status metric value of a result
+func statusValue(result string) float64 {
+	if val, ok := errorMapping[result]; ok {
+		return val
+	}
+	return errorMapping["Unknown"]
+}
 
-	if val, ok := errorMapping[errorType]; ok {
-		dnsrblStatus.WithLabelValues(blacklist, ip).Set(val)
-	} else {
-		dnsrblStatus.WithLabelValues(blacklist, ip).Set(errorMapping["Unknown"])
+// checkDomain checks a domain against a domain based blacklist (RHSBL, URIBL, DBL)
+// and returns the query result, with an empty result type if the check was skipped
+func checkDomain(resolver lookupResolver, domain string, list List) checkResult {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result := queryList(ctx, resolver, Target{Domain: domain}, list)
+	if result.Result != "" {
+		requestDuration.Observe(result.Duration.Seconds())
+		domainResultMetrics.record(list.Zone, domain, result)
 	}
+	return result
 }
 
+// convertToReverseIP builds the reversed query name of an IP address. IPv6
+// addresses are expanded and reversed nibble by nibble (RFC 5782 section 2.4).
 func convertToReverseIP(ip string) string {
+	if strings.Contains(ip, ":") {
+		if addr := net.ParseIP(ip); addr != nil {
+			var nibbles []string
+			for i := len(addr) - 1; i >= 0; i-- {
+				nibbles = append(nibbles, strconv.FormatUint(uint64(addr[i]&0x0f), 16), strconv.FormatUint(uint64(addr[i]>>4), 16))
+			}
+			return strings.Join(nibbles, ".")
+		}
+	}
+
 	parts := strings.Split(ip, ".")
 	// Reverse the slice
 	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
@@ -389,9 +863,10 @@ func getExternalIP() (string, error) {
 
 		ip := strings.TrimSpace(string(body))
 
-		// Validate that we got an IP address, not HTML
-		if net.ParseIP(ip) != nil {
-			return ip, nil
+		// Validate that we got an IP address, not HTML, and check IPv4-mapped
+		// addresses as IPv4 addresses
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			return addr.Unmap().String(), nil
 		}
 
 		lastErr = fmt.Errorf("invalid IP address received: %s", ip)
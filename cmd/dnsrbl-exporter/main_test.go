@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestConvertToReverseIP(t *testing.T) {
@@ -35,6 +38,16 @@ func TestConvertToReverseIP(t *testing.T) {
 			input:    "203.0.113.45",
 			expected: "45.113.0.203",
 		},
+		{
+			name:     "IPv6",
+			input:    "2001:db8:1:2:3:4:567:89ab",
+			expected: "b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.8.b.d.0.1.0.0.2",
+		},
+		{
+			name:     "compressed IPv6",
+			input:    "2001:db8::1",
+			expected: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2",
+		},
 	}
 
 	for _, tt := range tests {
@@ -54,6 +67,7 @@ func TestGetEnvAsInt(t *testing.T) {
 		envValue     string
 		defaultValue int
 		expected     int
+		wantErr      bool
 	}{
 		{
 			name:         "valid integer",
@@ -70,11 +84,18 @@ func TestGetEnvAsInt(t *testing.T) {
 			expected:     99,
 		},
 		{
-			name:         "invalid integer returns default",
+			name:         "invalid integer",
 			envKey:       "TEST_INT_3",
 			envValue:     "not_a_number",
 			defaultValue: 50,
-			expected:     50,
+			wantErr:      true,
+		},
+		{
+			name:         "duration is not an integer",
+			envKey:       "TEST_INT_6",
+			envValue:     "60s",
+			defaultValue: 60,
+			wantErr:      true,
 		},
 		{
 			name:         "zero value",
@@ -102,7 +123,16 @@ func TestGetEnvAsInt(t *testing.T) {
 				os.Setenv(tt.envKey, tt.envValue)
 			}
 
-			result := getEnvAsInt(tt.envKey, tt.defaultValue)
+			result, err := getEnvAsInt(tt.envKey, tt.defaultValue)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("getEnvAsInt(%q, %d) expected error but got none", tt.envKey, tt.defaultValue)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getEnvAsInt(%q, %d) unexpected error: %v", tt.envKey, tt.defaultValue, err)
+			}
 			if result != tt.expected {
 				t.Errorf("getEnvAsInt(%q, %d) = %d; want %d", tt.envKey, tt.defaultValue, result, tt.expected)
 			}
@@ -217,10 +247,10 @@ func TestLoadConfig_StaticIP(t *testing.T) {
 		os.Unsetenv("DNSRBL_LISTS")
 	}()
 
-	config := loadConfig()
+	config := mustLoadConfig(t, "")
 
-	if config.CheckIP != "192.168.1.1" {
-		t.Errorf("CheckIP = %q; want %q", config.CheckIP, "192.168.1.1")
+	if len(config.CheckIPs) != 1 || config.CheckIPs[0] != "192.168.1.1" {
+		t.Errorf("CheckIPs = %q; want %q", config.CheckIPs, []string{"192.168.1.1"})
 	}
 	if config.CheckIPMode != "static" {
 		t.Errorf("CheckIPMode = %q; want %q", config.CheckIPMode, "static")
@@ -231,21 +261,128 @@ func TestLoadConfig_StaticIP(t *testing.T) {
 	if config.DelayBetweenRuns != 120*time.Second {
 		t.Errorf("DelayBetweenRuns = %v; want %v", config.DelayBetweenRuns, 120*time.Second)
 	}
-	if config.Port != 9000 {
-		t.Errorf("Port = %d; want %d", config.Port, 9000)
+	if config.ListenAddress != ":9000" {
+		t.Errorf("ListenAddress = %q; want %q", config.ListenAddress, ":9000")
 	}
 	if len(config.Lists) != 2 {
 		t.Errorf("Lists length = %d; want %d", len(config.Lists), 2)
 	}
 }
 
+func TestLoadConfig_MultipleIPs(t *testing.T) {
+	os.Setenv("DNSRBL_CHECK_IP", "192.168.1.1, 192.168.1.2 10.0.0.1")
+	os.Setenv("DNSRBL_LISTS", "zen.spamhaus.org")
+	defer func() {
+		os.Unsetenv("DNSRBL_CHECK_IP")
+		os.Unsetenv("DNSRBL_LISTS")
+	}()
+
+	config := mustLoadConfig(t, "")
+
+	expected := []string{"192.168.1.1", "192.168.1.2", "10.0.0.1"}
+	if len(config.CheckIPs) != len(expected) {
+		t.Fatalf("CheckIPs = %q; want %q", config.CheckIPs, expected)
+	}
+	for i, ip := range expected {
+		if config.CheckIPs[i] != ip {
+			t.Errorf("CheckIPs[%d] = %q; want %q", i, config.CheckIPs[i], ip)
+		}
+	}
+	if config.CheckIPMode != "static" {
+		t.Errorf("CheckIPMode = %q; want %q", config.CheckIPMode, "static")
+	}
+}
+
+func TestLoadConfig_CheckIPFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "ips.txt")
+	content := "# mail relays\n192.168.1.1\n\n192.168.1.2\n"
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+
+	os.Unsetenv("DNSRBL_CHECK_IP")
+	os.Setenv("DNSRBL_CHECK_IP_FILENAME", tmpFile)
+	os.Setenv("DNSRBL_LISTS", "zen.spamhaus.org")
+	defer func() {
+		os.Unsetenv("DNSRBL_CHECK_IP_FILENAME")
+		os.Unsetenv("DNSRBL_LISTS")
+	}()
+
+	config := mustLoadConfig(t, "")
+
+	if len(config.CheckIPs) != 2 {
+		t.Fatalf("CheckIPs = %q; want 2 entries", config.CheckIPs)
+	}
+	if config.CheckIPs[0] != "192.168.1.1" || config.CheckIPs[1] != "192.168.1.2" {
+		t.Errorf("CheckIPs = %q; want %q", config.CheckIPs, []string{"192.168.1.1", "192.168.1.2"})
+	}
+	if config.CheckIPMode != "static" {
+		t.Errorf("CheckIPMode = %q; want %q", config.CheckIPMode, "static")
+	}
+}
+
+func TestLoadConfig_Domains(t *testing.T) {
+	os.Unsetenv("DNSRBL_CHECK_IP")
+	os.Setenv("DNSRBL_CHECK_DOMAIN", "example.com mail.example.org")
+	os.Setenv("DNSRBL_LISTS", "zen.spamhaus.org dbl.spamhaus.org:domain")
+	defer func() {
+		os.Unsetenv("DNSRBL_CHECK_DOMAIN")
+		os.Unsetenv("DNSRBL_LISTS")
+	}()
+
+	config := mustLoadConfig(t, "")
+
+	if len(config.Targets) != 2 {
+		t.Fatalf("Targets = %+v; want 2 domain targets", config.Targets)
+	}
+	if config.Targets[0].Domain != "example.com" || config.Targets[1].Domain != "mail.example.org" {
+		t.Errorf("Targets = %+v", config.Targets)
+	}
+	if config.CheckIPMode != "static" {
+		t.Errorf("CheckIPMode = %q; want %q", config.CheckIPMode, "static")
+	}
+	if config.Lists[1].Type != listTypeDomain {
+		t.Errorf("Lists[1].Type = %q; want %q", config.Lists[1].Type, listTypeDomain)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{name: "single", input: "192.168.1.1", expected: []string{"192.168.1.1"}},
+		{name: "spaces", input: "192.168.1.1 192.168.1.2", expected: []string{"192.168.1.1", "192.168.1.2"}},
+		{name: "commas", input: "192.168.1.1,192.168.1.2", expected: []string{"192.168.1.1", "192.168.1.2"}},
+		{name: "mixed", input: " 192.168.1.1, 192.168.1.2\t", expected: []string{"192.168.1.1", "192.168.1.2"}},
+		{name: "empty", input: "", expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := splitList(tt.input)
+			if len(result) != len(tt.expected) {
+				t.Fatalf("splitList(%q) = %q; want %q", tt.input, result, tt.expected)
+			}
+			for i := range result {
+				if result[i] != tt.expected[i] {
+					t.Errorf("splitList(%q)[%d] = %q; want %q", tt.input, i, result[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
 func TestLoadConfig_DynamicIP(t *testing.T) {
 	// Ensure DNSRBL_CHECK_IP is not set
 	os.Unsetenv("DNSRBL_CHECK_IP")
+	os.Unsetenv("DNSRBL_CHECK_IP_FILENAME")
 	os.Setenv("DNSRBL_LISTS", "zen.spamhaus.org")
 	defer os.Unsetenv("DNSRBL_LISTS")
 
-	config := loadConfig()
+	config := mustLoadConfig(t, "")
 
 	if config.CheckIPMode != "dynamic" {
 		t.Errorf("CheckIPMode = %q; want %q", config.CheckIPMode, "dynamic")
@@ -255,6 +392,7 @@ func TestLoadConfig_DynamicIP(t *testing.T) {
 func TestLoadConfig_Defaults(t *testing.T) {
 	// Clear all relevant environment variables
 	os.Unsetenv("DNSRBL_CHECK_IP")
+	os.Unsetenv("DNSRBL_CHECK_IP_FILENAME")
 	os.Unsetenv("DNSRBL_DELAY_REQUESTS")
 	os.Unsetenv("DNSRBL_DELAY_RUNS")
 	os.Unsetenv("DNSRBL_PORT")
@@ -274,7 +412,7 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	os.Chdir(tmpDir)
 	defer os.Chdir(oldWd)
 
-	config := loadConfig()
+	config := mustLoadConfig(t, "")
 
 	if config.DelayBetweenRequests != 1*time.Second {
 		t.Errorf("DelayBetweenRequests = %v; want %v", config.DelayBetweenRequests, 1*time.Second)
@@ -282,69 +420,118 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	if config.DelayBetweenRuns != 60*time.Second {
 		t.Errorf("DelayBetweenRuns = %v; want %v", config.DelayBetweenRuns, 60*time.Second)
 	}
-	if config.Port != 8000 {
-		t.Errorf("Port = %d; want %d", config.Port, 8000)
+	if config.ListenAddress != ":8000" {
+		t.Errorf("ListenAddress = %q; want %q", config.ListenAddress, ":8000")
 	}
 }
 
-func TestHandleDNSError(t *testing.T) {
-	tests := []struct {
-		name      string
-		err       error
-		blacklist string
-		ip        string
-	}{
-		{
-			name:      "not found error",
-			err:       &net.DNSError{Err: "no such host", IsNotFound: true},
-			blacklist: "test.blacklist.org",
-			ip:        "192.168.1.1",
-		},
-		{
-			name:      "timeout error",
-			err:       &net.DNSError{Err: "timeout", IsTimeout: true},
-			blacklist: "test.blacklist.org",
-			ip:        "192.168.1.1",
-		},
-		{
-			name:      "unknown error",
-			err:       &net.DNSError{Err: "unknown error"},
-			blacklist: "test.blacklist.org",
-			ip:        "192.168.1.1",
-		},
+// stubResolver answers all queries with the same addresses or error
+type stubResolver struct {
+	ips []net.IP
+	err error
+}
+
+func (r *stubResolver) lookupIP(ctx context.Context, query string) ([]net.IP, error) {
+	return r.ips, r.err
+}
+
+func (r *stubResolver) lookupTXT(ctx context.Context, query string) ([]string, error) {
+	return nil, r.err
+}
+
+func TestRunChecks_Canceled(t *testing.T) {
+	resolvers := &resolverSet{lists: make(map[string]lookupResolver)}
+	var jobs []checkJob
+	for i := 0; i < 3; i++ {
+		list := List{Zone: fmt.Sprintf("bl%d.example.org", i), Type: listTypeIP, IPv4: true}
+		resolvers.lists[list.Zone] = &stubResolver{err: &net.DNSError{Err: "no such host", IsNotFound: true}}
+		jobs = append(jobs, checkJob{Target: Target{IP: "192.0.2.1"}, List: list})
+		defer checkResults.delete(list.Zone, "192.0.2.1")
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// This function updates metrics, so we just ensure it doesn't panic
-			handleDNSError(tt.err, tt.blacklist, tt.ip)
-		})
+	start := time.Now()
+	sched := newScheduler(time.Hour, 0)
+	sched.update(jobs, start)
+
+	// The delay lets the first check run, the others wait until the checks
+	// are canceled, e.g. by a reload
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	runChecks(ctx, sched.due(start), &Config{}, sched, newCheckPool(1, time.Hour, 0), newCIDRTracker(), resolvers)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("runChecks() returned after %v; want it to stop when canceled", elapsed)
+	}
+	if due := sched.due(time.Now()); len(due) != 2 {
+		t.Errorf("due checks after canceling = %v; want the 2 checks not started", due)
+	}
+	started := checkResults.filter(func(status CheckStatus) bool {
+		_, ok := resolvers.lists[status.List]
+		return ok && status.Target == "192.0.2.1"
+	})
+	if len(started) != 1 || started[0].List != "bl0.example.org" {
+		t.Errorf("results = %+v; want the result of the started check", started)
 	}
 }
 
-func TestLookupIP(t *testing.T) {
-	// Test with a known good DNS query (Google's public DNS)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func TestRunChecks_CIDRListed(t *testing.T) {
+	defer dnsrblCIDRListed.Reset()
+
+	resolver := &stubResolver{}
+	list := List{Zone: "bl.example.org", Type: listTypeIP, IPv4: true}
+	resolvers := &resolverSet{lists: map[string]lookupResolver{list.Zone: resolver}}
+	job := checkJob{Target: Target{IP: "203.0.113.1", CIDR: "203.0.113.0/30"}, List: list}
+	defer checkResults.delete(list.Zone, job.Target.IP)
+	defer listingEvents.forget(list.Zone, job.Target.IP)
+
+	sched := newScheduler(time.Hour, 0)
+	sched.update([]checkJob{job}, time.Now())
+	cidrs := newCIDRTracker()
+	check := func(ips []net.IP, err error) float64 {
+		resolver.ips, resolver.err = ips, err
+		runChecks(context.Background(), []checkJob{job}, &Config{}, sched, newCheckPool(1, 0, 0), cidrs, resolvers)
+		return testutil.ToFloat64(dnsrblCIDRListed.WithLabelValues(list.Zone, job.Target.CIDR))
+	}
 
-	ips, err := lookupIP(ctx, "google.com")
-	if err != nil {
-		t.Logf("lookupIP failed (this may be expected in some environments): %v", err)
+	// Failed checks keep the address listed until it is no longer found
+	if got := check([]net.IP{net.IPv4(127, 0, 0, 2)}, nil); got != 1 {
+		t.Errorf("dnsrbl_cidr_listed after listing = %v; want 1", got)
+	}
+	if got := check(nil, &net.DNSError{Err: "i/o timeout", IsTimeout: true}); got != 1 {
+		t.Errorf("dnsrbl_cidr_listed after a timeout = %v; want 1", got)
 	}
-	if len(ips) == 0 && err == nil {
-		t.Error("lookupIP returned no IPs and no error")
+	if got := check(nil, &net.DNSError{Err: "no such host", IsNotFound: true}); got != 0 {
+		t.Errorf("dnsrbl_cidr_listed after delisting = %v; want 0", got)
 	}
 }
 
-func TestLookupIP_Timeout(t *testing.T) {
-	// Create a context with very short timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Nanosecond)
-	defer cancel()
+func TestPairLabels(t *testing.T) {
+	if got := pairLabels("zen.spamhaus.org", "2001:db8::1"); got["ip"] != "2001:db8::1" || got["domain"] != "" {
+		t.Errorf("pairLabels(IP) = %v", got)
+	}
+	if got := pairLabels("dbl.spamhaus.org", "example.com"); got["ip"] != "" || got["domain"] != "example.com" {
+		t.Errorf("pairLabels(domain) = %v", got)
+	}
+}
 
-	// This should timeout or fail quickly
-	_, err := lookupIP(ctx, "test.invalid.blacklist.example.com")
-	if err == nil {
-		t.Log("Expected timeout error but got none (may be cached)")
+func TestClassifyDNSError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "not found", err: &net.DNSError{Err: "no such host", IsNotFound: true}, expected: "NXDOMAIN"},
+		{name: "timeout", err: &net.DNSError{Err: "timeout", IsTimeout: true}, expected: "Timeout"},
+		{name: "other DNS error", err: &net.DNSError{Err: "server misbehaving"}, expected: "Unknown"},
+		{name: "non DNS error", err: context.Canceled, expected: "Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := classifyDNSError(tt.err); result != tt.expected {
+				t.Errorf("classifyDNSError(%v) = %q; want %q", tt.err, result, tt.expected)
+			}
+		})
 	}
 }
 
@@ -360,6 +547,6 @@ func BenchmarkGetEnvAsInt(b *testing.B) {
 	defer os.Unsetenv("BENCH_TEST_INT")
 
 	for i := 0; i < b.N; i++ {
-		getEnvAsInt("BENCH_TEST_INT", 10)
+		_, _ = getEnvAsInt("BENCH_TEST_INT", 10)
 	}
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultModule is the name of the module checking all lists
+const defaultModule = "default"
+
+// Module is a named profile selecting the lists and settings targets are
+// checked with, e.g. all lists for mail relays or a few abuse lists for
+// web servers
+type Module struct {
+	Name     string
+	Lists    []string      // Zones of the module, all lists if empty
+	Interval time.Duration // Check interval replacing the intervals of the lists
+}
+
+// configModule is a module of the configuration file
+type configModule struct {
+	Lists    []string `yaml:"lists"`
+	Interval string   `yaml:"interval"`
+}
+
+// toModule validates a module of the configuration file against the configured lists
+func (c configModule) toModule(name string, lists []List) (Module, error) {
+	if name == "" || strings.ContainsAny(name, "@/: ") {
+		return Module{}, fmt.Errorf("invalid module name %q", name)
+	}
+
+	zones := make(map[string]bool, len(lists))
+	for _, list := range lists {
+		zones[list.Zone] = true
+	}
+
+	module := Module{Name: name}
+	seen := make(map[string]bool)
+	for _, zone := range c.Lists {
+		if !zones[zone] {
+			return Module{}, fmt.Errorf("module %s: unknown list %s", name, zone)
+		}
+		if !seen[zone] {
+			seen[zone] = true
+			module.Lists = append(module.Lists, zone)
+		}
+	}
+
+	if c.Interval != "" {
+		interval, err := parseDuration(c.Interval)
+		if err != nil || interval <= 0 {
+			return Module{}, fmt.Errorf("module %s: invalid interval %q", name, c.Interval)
+		}
+		module.Interval = interval
+	}
+
+	return module, nil
+}
+
+// lists returns the lists of the module
+func (m Module) lists(lists []List) []List {
+	if len(m.Lists) == 0 && m.Interval == 0 {
+		return lists
+	}
+
+	zones := make(map[string]bool, len(m.Lists))
+	for _, zone := range m.Lists {
+		zones[zone] = true
+	}
+
+	var selected []List
+	for _, list := range lists {
+		if len(zones) > 0 && !zones[list.Zone] {
+			continue
+		}
+		if m.Interval > 0 {
+			list.Interval = m.Interval
+		}
+		selected = append(selected, list)
+	}
+	return selected
+}
+
+// moduleLists returns the lists of a module. Targets without a module are
+// checked against all lists, unless a module named default is configured.
+func moduleLists(lists []List, modules map[string]Module, name string) ([]List, error) {
+	if name == "" {
+		name = defaultModule
+	}
+	if module, ok := modules[name]; ok {
+		return module.lists(lists), nil
+	}
+	if name == defaultModule {
+		return lists, nil
+	}
+	return nil, fmt.Errorf("unknown module %q", name)
+}
+
+// checkJobs returns the supported (list, target) pairs of the targets, each
+// target using the lists of its module
+func checkJobs(targets []Target, lists []List, modules map[string]Module) []checkJob {
+	var jobs []checkJob
+	for _, target := range targets {
+		targetLists, err := moduleLists(lists, modules, target.Module)
+		if err != nil {
+			continue
+		}
+		for _, list := range targetLists {
+			if list.supports(target) {
+				jobs = append(jobs, checkJob{Target: target, List: list})
+			}
+		}
+	}
+	return jobs
+}
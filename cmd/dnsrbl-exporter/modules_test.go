@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testModuleLists = []List{
+	{Zone: "zen.spamhaus.org", Type: listTypeIP, IPv4: true, IPv6: true},
+	{Zone: "bl.spamcop.net", Type: listTypeIP, IPv4: true, Interval: time.Hour},
+	{Zone: "dbl.spamhaus.org", Type: listTypeDomain},
+}
+
+func zones(lists []List) string {
+	var zones []string
+	for _, list := range lists {
+		zones = append(zones, list.Zone)
+	}
+	return strings.Join(zones, ",")
+}
+
+func TestConfigModule_ToModule(t *testing.T) {
+	tests := []struct {
+		name    string
+		module  string
+		entry   configModule
+		wantErr bool
+	}{
+		{name: "lists", module: "web", entry: configModule{Lists: []string{"zen.spamhaus.org"}}},
+		{name: "interval", module: "strict", entry: configModule{Interval: "5m"}},
+		{name: "unknown list", module: "web", entry: configModule{Lists: []string{"bl.example.org"}}, wantErr: true},
+		{name: "invalid interval", module: "web", entry: configModule{Interval: "often"}, wantErr: true},
+		{name: "zero interval", module: "web", entry: configModule{Interval: "0s"}, wantErr: true},
+		{name: "invalid name", module: "web@frontend", wantErr: true},
+		{name: "empty name", module: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.entry.toModule(tt.module, testModuleLists)
+			if tt.wantErr && err == nil {
+				t.Errorf("toModule(%q) expected error but got none", tt.module)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("toModule(%q) unexpected error: %v", tt.module, err)
+			}
+		})
+	}
+}
+
+func TestModuleLists(t *testing.T) {
+	modules := map[string]Module{
+		"web":    {Name: "web", Lists: []string{"zen.spamhaus.org", "dbl.spamhaus.org"}},
+		"strict": {Name: "strict", Interval: 5 * time.Minute},
+	}
+
+	tests := []struct {
+		name     string
+		modules  map[string]Module
+		module   string
+		expected string
+		wantErr  bool
+	}{
+		{name: "no module", modules: modules, module: "", expected: "zen.spamhaus.org,bl.spamcop.net,dbl.spamhaus.org"},
+		{name: "default", modules: modules, module: "default", expected: "zen.spamhaus.org,bl.spamcop.net,dbl.spamhaus.org"},
+		{name: "subset", modules: modules, module: "web", expected: "zen.spamhaus.org,dbl.spamhaus.org"},
+		{name: "interval", modules: modules, module: "strict", expected: "zen.spamhaus.org,bl.spamcop.net,dbl.spamhaus.org"},
+		{name: "configured default", modules: map[string]Module{"default": modules["web"]}, module: "", expected: "zen.spamhaus.org,dbl.spamhaus.org"},
+		{name: "unknown", modules: modules, module: "mail", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lists, err := moduleLists(testModuleLists, tt.modules, tt.module)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("moduleLists(%q) expected error but got none", tt.module)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("moduleLists(%q) unexpected error: %v", tt.module, err)
+			}
+			if got := zones(lists); got != tt.expected {
+				t.Errorf("moduleLists(%q) = %s; want %s", tt.module, got, tt.expected)
+			}
+		})
+	}
+
+	// Module intervals replace the list intervals without changing the lists
+	lists, _ := moduleLists(testModuleLists, modules, "strict")
+	for _, list := range lists {
+		if list.Interval != 5*time.Minute {
+			t.Errorf("moduleLists(strict) interval of %s = %v; want %v", list.Zone, list.Interval, 5*time.Minute)
+		}
+	}
+	if testModuleLists[1].Interval != time.Hour {
+		t.Errorf("moduleLists() changed the interval of the configured list")
+	}
+}
+
+func TestCheckJobs(t *testing.T) {
+	modules := map[string]Module{
+		"web": {Name: "web", Lists: []string{"bl.spamcop.net"}},
+	}
+	targets := []Target{
+		{IP: "192.0.2.1"},
+		{IP: "192.0.2.2", Module: "web"},
+		{IP: "2001:db8::1", Module: "web"},
+		{Domain: "example.com"},
+		{IP: "192.0.2.3", Module: "unknown"},
+	}
+
+	var pairs []string
+	for _, job := range checkJobs(targets, testModuleLists, modules) {
+		pairs = append(pairs, job.List.Zone+"|"+job.Target.String())
+	}
+
+	expected := "zen.spamhaus.org|192.0.2.1,bl.spamcop.net|192.0.2.1,bl.spamcop.net|192.0.2.2,dbl.spamhaus.org|example.com"
+	if got := strings.Join(pairs, ","); got != expected {
+		t.Errorf("checkJobs() = %s; want %s", got, expected)
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Defaults of the notifications
+const (
+	defaultNotificationRetries = 3
+	defaultNotificationBackoff = time.Second
+	defaultDedupWindow         = time.Hour
+	defaultWebhookTimeout      = 10 * time.Second
+	maxNotificationBackoff     = time.Minute
+)
+
+// Notifications configures how listing events are sent to other systems
+type Notifications struct {
+	Webhooks     []Webhook
+	Email        *Email
+	Alertmanager *Alertmanager
+	Retries      int           // Retries of a failed delivery
+	Backoff      time.Duration // Delay before the first retry, doubled for each further retry
+	DedupWindow  time.Duration // Time a delivered notification suppresses repeats of the same state
+
+	// NotifyInitial sends listings found on the first check of a target and
+	// list, and their delistings
+	NotifyInitial bool
+}
+
+// Webhook receives listing events as HTTP requests with a JSON body
+type Webhook struct {
+	URL      string
+	Format   string // Format of the body, see formats.go
+	Headers  map[string]string
+	Template *template.Template // Template of the body in the JSON format, the notification as JSON if nil
+	Timeout  time.Duration
+	Room     string // Room ID of the Matrix format
+	Token    string // Access token of the Matrix format
+}
+
+// configNotifications are the notifications of the configuration file
+type configNotifications struct {
+	Webhooks      []configWebhook     `yaml:"webhooks"`
+	Email         *configEmail        `yaml:"email"`
+	Alertmanager  *configAlertmanager `yaml:"alertmanager"`
+	Retries       *int                `yaml:"retries"`
+	Backoff       string              `yaml:"backoff"`
+	DedupWindow   string              `yaml:"dedup_window"`
+	NotifyInitial *bool               `yaml:"notify_initial"`
+}
+
+// configWebhook is a webhook of the configuration file
+type configWebhook struct {
+	URL      string            `yaml:"url"`
+	Format   string            `yaml:"format"`
+	Headers  map[string]string `yaml:"headers"`
+	Template string            `yaml:"template"`
+	Timeout  string            `yaml:"timeout"`
+	Room     string            `yaml:"room"`
+	Token    string            `yaml:"token"`
+}
+
+// apply sets the notifications of the configuration file on a configuration
+func (c configNotifications) apply(notifications *Notifications) error {
+	if c.Retries != nil {
+		notifications.Retries = *c.Retries
+	}
+	if c.NotifyInitial != nil {
+		notifications.NotifyInitial = *c.NotifyInitial
+	}
+	for _, setting := range []struct {
+		key   string
+		value string
+		dest  *time.Duration
+	}{
+		{"notifications.backoff", c.Backoff, &notifications.Backoff},
+		{"notifications.dedup_window", c.DedupWindow, &notifications.DedupWindow},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		duration, err := parseDuration(setting.value)
+		if err != nil || duration < 0 {
+			return fmt.Errorf("invalid %s %q", setting.key, setting.value)
+		}
+		*setting.dest = duration
+	}
+
+	for i, entry := range c.Webhooks {
+		webhook, err := entry.toWebhook()
+		if err != nil {
+			return fmt.Errorf("webhook %d: %w", i+1, err)
+		}
+		notifications.Webhooks = append(notifications.Webhooks, webhook)
+	}
+	if c.Email != nil {
+		email, err := c.Email.toEmail()
+		if err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+		notifications.Email = &email
+	}
+	if c.Alertmanager != nil {
+		alertmanager, err := c.Alertmanager.toAlertmanager()
+		if err != nil {
+			return fmt.Errorf("alertmanager: %w", err)
+		}
+		notifications.Alertmanager = &alertmanager
+	}
+	return nil
+}
+
+// toWebhook validates a webhook of the configuration file. ${VAR} references
+// in the URL, the headers and the token are expanded from the environment.
+func (c configWebhook) toWebhook() (Webhook, error) {
+	webhook := Webhook{
+		URL:     os.ExpandEnv(c.URL),
+		Format:  c.Format,
+		Timeout: defaultWebhookTimeout,
+		Room:    c.Room,
+		Token:   os.ExpandEnv(c.Token),
+	}
+	if webhook.Format == "" {
+		webhook.Format = formatJSON
+	}
+	if c.Timeout != "" {
+		timeout, err := parseDuration(c.Timeout)
+		if err != nil || timeout <= 0 {
+			return Webhook{}, fmt.Errorf("invalid timeout %q", c.Timeout)
+		}
+		webhook.Timeout = timeout
+	}
+	if len(c.Headers) > 0 {
+		webhook.Headers = make(map[string]string, len(c.Headers))
+		for name, value := range c.Headers {
+			webhook.Headers[name] = os.ExpandEnv(value)
+		}
+	}
+	if c.Template != "" {
+		if webhook.Format != formatJSON {
+			return Webhook{}, fmt.Errorf("templates are only supported in the %s format", formatJSON)
+		}
+		tmpl, err := parsePayloadTemplate(c.Template)
+		if err != nil {
+			return Webhook{}, err
+		}
+		webhook.Template = tmpl
+	}
+	return webhook, webhook.validate()
+}
+
+// validate checks the URL and format of a webhook
+func (w Webhook) validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: must be an http or https URL", w.URL)
+	}
+
+	switch w.Format {
+	case formatJSON, formatSlack, formatTeams:
+		if w.Room != "" || w.Token != "" {
+			return fmt.Errorf("room and token are only supported in the %s format", formatMatrix)
+		}
+	case formatMatrix:
+		if w.Room == "" || w.Token == "" {
+			return fmt.Errorf("the %s format requires a room and a token", formatMatrix)
+		}
+	default:
+		return fmt.Errorf("unknown webhook format %q", w.Format)
+	}
+	return nil
+}
+
+// kind returns the kind of notifier the webhook is reported as in the metrics
+func (w Webhook) kind() string {
+	if w.Format == formatJSON {
+		return "webhook"
+	}
+	return w.Format
+}
+
+// name returns the webhook URL without path and credentials for logging, as
+// many services embed secrets in the path
+func (w Webhook) name() string {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// parsePayloadTemplate parses the template of a webhook body. The template
+// must render sample notifications to valid JSON.
+func parsePayloadTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("payload").Funcs(template.FuncMap{
+		"json": func(value any) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	samples := []ListingEvent{
+		{Type: eventListed, List: "zen.spamhaus.org", Target: "192.0.2.1", Sublists: []string{"sbl"}, Reason: "\"quoted\" reason"},
+		{Type: eventDelisted, List: "zen.spamhaus.org", Target: "192.0.2.1", Duration: 3600},
+	}
+	for _, sample := range samples {
+		if _, err := renderPayload(tmpl, newNotification(sample, List{Zone: sample.List})); err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+	}
+	return tmpl, nil
+}
+
+// Notification is a listing event as sent to notifiers
+type Notification struct {
+	ID string `json:"id"` // Same for all deliveries of an event, so receivers can drop duplicates
+	ListingEvent
+	ListName  string `json:"list_name"`
+	DelistURL string `json:"delist_url,omitempty"`
+}
+
+func newNotification(event ListingEvent, list List) Notification {
+	sum := sha256.Sum256([]byte(event.Type + "|" + event.List + "|" + event.Target + "|" + event.Time.UTC().Format(time.RFC3339Nano)))
+	return Notification{
+		ID:           hex.EncodeToString(sum[:8]),
+		ListingEvent: event,
+		ListName:     list.displayName(),
+		DelistURL:    list.DelistURL,
+	}
+}
+
+// Summary describes the event in a sentence
+func (n Notification) Summary() string {
+	if n.Type == eventDelisted {
+		return fmt.Sprintf("%s is no longer listed in %s after %v", n.Target, n.List, time.Duration(n.Duration*float64(time.Second)).Round(time.Second))
+	}
+
+	summary := fmt.Sprintf("%s is listed in %s", n.Target, n.List)
+	if len(n.Sublists) > 0 {
+		summary += " (" + strings.Join(n.Sublists, ", ") + ")"
+	}
+	if n.Reason != "" {
+		summary += ": " + n.Reason
+	}
+	return summary
+}
+
+// renderPayload renders the body of a notification, the notification as JSON
+// without template
+func renderPayload(tmpl *template.Template, notification Notification) ([]byte, error) {
+	if tmpl == nil {
+		return json.Marshal(notification)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, notification); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template rendered invalid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// notifier sends listing events to the configured webhooks and email
+// recipients in the background
+type notifier struct {
+	mu            sync.Mutex
+	notifications Notifications
+	delivered     map[string]delivery // latest delivered notification by receiver, list and target
+	digest        []queuedMail        // notifications waiting for the next email digest
+	client        *http.Client
+	wg            sync.WaitGroup
+}
+
+// delivery is a delivered notification
+type delivery struct {
+	event string
+	time  time.Time
+}
+
+func newNotifier(notifications Notifications) *notifier {
+	return &notifier{
+		notifications: notifications,
+		delivered:     make(map[string]delivery),
+		client:        &http.Client{},
+	}
+}
+
+var eventNotifier = newNotifier(Notifications{})
+
+// update replaces the configuration used for future events
+func (n *notifier) update(notifications Notifications) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.notifications = notifications
+}
+
+// notify sends an event of a list to all webhooks and by email. Initial
+// events are only sent if enabled, as they do not tell whether the target
+// was listed before the start. Events repeating the state last delivered to
+// a receiver within the dedup window are suppressed.
+func (n *notifier) notify(event ListingEvent, list List) {
+	notification := newNotification(event, list)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if event.Initial && !n.notifications.NotifyInitial {
+		log.Printf("Not notifying the initial %s event of %s on %s", event.Type, event.Target, event.List)
+		return
+	}
+
+	for key, last := range n.delivered {
+		if event.Time.Sub(last.time) > n.notifications.DedupWindow {
+			delete(n.delivered, key)
+		}
+	}
+
+	retries, backoff := n.notifications.Retries, n.notifications.Backoff
+	for _, webhook := range n.notifications.Webhooks {
+		claim, ok := n.claim(webhook.URL+"|"+webhook.Room, webhook.kind(), webhook.name(), event)
+		if !ok {
+			continue
+		}
+
+		n.wg.Add(1)
+		go func(webhook Webhook) {
+			defer n.wg.Done()
+			n.finish(claim, n.deliver(webhook, notification, retries, backoff))
+		}(webhook)
+	}
+
+	if email := n.notifications.Email; email != nil {
+		claim, ok := n.claim("email", "email", email.name(), event)
+		if !ok {
+			return
+		}
+
+		if email.Digest > 0 {
+			n.queueDigest(queuedMail{claim: claim, notification: notification}, email.Digest)
+			return
+		}
+		n.wg.Add(1)
+		go func(email Email) {
+			defer n.wg.Done()
+			n.finish(claim, n.deliverMail(email, []Notification{notification}, retries, backoff))
+		}(*email)
+	}
+}
+
+// claim is a notification of an event claimed for delivery to a receiver
+type claim struct {
+	key   string
+	kind  string // kind of receiver reported in the metrics
+	name  string // name of the receiver for logging
+	event ListingEvent
+	sent  delivery
+}
+
+// claim suppresses an event repeating the state last delivered to a receiver.
+// Otherwise the event counts as delivered right away, so that events following
+// quickly are deduplicated while it is still retried. The lock must be held.
+func (n *notifier) claim(receiver, kind, name string, event ListingEvent) (claim, bool) {
+	key := receiver + "|" + reasonKey(event.List, event.Target)
+	if last, ok := n.delivered[key]; ok && last.event == event.Type {
+		log.Printf("Suppressing duplicate %s notification of %s on %s to %s", event.Type, event.Target, event.List, name)
+		dnsrblNotifications.WithLabelValues(kind, "suppressed").Inc()
+		return claim{}, false
+	}
+
+	c := claim{key: key, kind: kind, name: name, event: event, sent: delivery{event: event.Type, time: event.Time}}
+	n.delivered[key] = c.sent
+	return c, true
+}
+
+// finish records the outcome of the delivery of a claimed notification
+func (n *notifier) finish(c claim, err error) {
+	if err == nil {
+		dnsrblNotifications.WithLabelValues(c.kind, "sent").Inc()
+		return
+	}
+
+	log.Printf("Failed to send %s notification of %s on %s to %s: %v", c.event.Type, c.event.Target, c.event.List, c.name, err)
+	dnsrblNotifications.WithLabelValues(c.kind, "failed").Inc()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.delivered[c.key] == c.sent {
+		delete(n.delivered, c.key)
+	}
+}
+
+// wait waits for all pending deliveries, including queued digests
+func (n *notifier) wait() {
+	n.wg.Wait()
+}
+
+// deliver sends a notification to a webhook, retrying with exponential
+// backoff on connection errors, 429 and 5xx responses
+func (n *notifier) deliver(webhook Webhook, notification Notification, retries int, backoff time.Duration) error {
+	method, endpoint := webhook.endpoint(notification)
+	body, err := webhook.payload(notification)
+	if err != nil {
+		return err
+	}
+
+	return withRetries(webhook.name(), retries, backoff, func() (bool, error) {
+		return sendRequest(n.client, webhook, method, endpoint, body)
+	})
+}
+
+// withRetries runs an attempt until it succeeds, fails permanently or all
+// retries are used, doubling the delay between attempts
+func withRetries(name string, retries int, backoff time.Duration, attempt func() (bool, error)) error {
+	for i := 0; ; i++ {
+		retry, err := attempt()
+		if err == nil {
+			return nil
+		}
+		if !retry || i >= retries {
+			return err
+		}
+
+		delay := min(backoff<<i, maxNotificationBackoff)
+		log.Printf("Retrying notification to %s in %v: %v", name, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// sendRequest sends a body with the headers of a webhook and reports whether a
+// failure may be retried
+func sendRequest(client *http.Client, webhook Webhook, method, endpoint string, body []byte) (bool, error) {
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dnsrbl-exporter/"+Version)
+	if webhook.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+webhook.Token)
+	}
+	for name, value := range webhook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	timed := *client
+	timed.Timeout = webhook.Timeout
+	resp, err := timed.Do(req)
+	if err != nil {
+		// Hide the URL, it may contain secrets
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
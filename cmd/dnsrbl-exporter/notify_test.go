@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testReceiver is a webhook receiver answering with the given status codes in turn
+type testReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newTestReceiver(t *testing.T, statuses ...int) (*testReceiver, string) {
+	t.Helper()
+	receiver := &testReceiver{statuses: statuses}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	return receiver, server.URL + "/hooks/secret"
+}
+
+func (r *testReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *testReceiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+var testList = List{Zone: "zen.spamhaus.org", Name: "Spamhaus ZEN", DelistURL: "https://check.spamhaus.org/"}
+
+func testEvent(eventType string, at time.Time) ListingEvent {
+	event := ListingEvent{Time: at, Type: eventType, List: "zen.spamhaus.org", Target: "192.0.2.1"}
+	if eventType == eventListed {
+		event.Sublists = []string{"sbl"}
+		event.Reason = "Listed in SBL"
+	} else {
+		event.Duration = 5400
+	}
+	return event
+}
+
+func TestNotifierDefaultPayload(t *testing.T) {
+	receiver, url := newTestReceiver(t)
+	n := newNotifier(Notifications{Webhooks: []Webhook{{URL: url, Timeout: time.Second}}})
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	n.notify(testEvent(eventListed, at), testList)
+	n.wait()
+
+	bodies := receiver.received()
+	if len(bodies) != 1 {
+		t.Fatalf("received %d notifications; want 1", len(bodies))
+	}
+	var notification Notification
+	if err := json.Unmarshal([]byte(bodies[0]), &notification); err != nil {
+		t.Fatalf("invalid JSON %s: %v", bodies[0], err)
+	}
+	if notification.ID == "" || notification.Type != eventListed || notification.Target != "192.0.2.1" ||
+		notification.List != "zen.spamhaus.org" || !notification.Time.Equal(at) || notification.Reason != "Listed in SBL" {
+		t.Errorf("notification = %+v", notification)
+	}
+	if got := receiver.requests[0].Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q; want application/json", got)
+	}
+}
+
+func TestNotifierTemplate(t *testing.T) {
+	t.Setenv("TEST_WEBHOOK_TOKEN", "secret")
+	receiver, url := newTestReceiver(t)
+	webhook, err := configWebhook{
+		URL:      url,
+		Headers:  map[string]string{"Authorization": "Bearer ${TEST_WEBHOOK_TOKEN}"},
+		Template: `{"text": {{json .Summary}}, "id": {{json .ID}}}`,
+	}.toWebhook()
+	if err != nil {
+		t.Fatalf("toWebhook() error = %v", err)
+	}
+	n := newNotifier(Notifications{Webhooks: []Webhook{webhook}})
+
+	n.notify(testEvent(eventDelisted, time.Now()), testList)
+	n.wait()
+
+	bodies := receiver.received()
+	if len(bodies) != 1 {
+		t.Fatalf("received %d notifications; want 1", len(bodies))
+	}
+	var body struct {
+		Text string `json:"text"`
+		ID   string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &body); err != nil {
+		t.Fatalf("invalid JSON %s: %v", bodies[0], err)
+	}
+	if body.Text != "192.0.2.1 is no longer listed in zen.spamhaus.org after 1h30m0s" || body.ID == "" {
+		t.Errorf("body = %+v", body)
+	}
+	if got := receiver.requests[0].Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q; want %q", got, "Bearer secret")
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	dnsrblNotifications.Reset()
+	defer dnsrblNotifications.Reset()
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		retries   int
+		requests  int
+		delivered bool
+	}{
+		{"success", []int{200}, 3, 1, true},
+		{"retried server errors", []int{500, 503, 204}, 3, 3, true},
+		{"retried rate limit", []int{429, 200}, 3, 2, true},
+		{"retries exhausted", []int{500, 500, 500}, 2, 3, false},
+		{"client error not retried", []int{400, 200}, 3, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dnsrblNotifications.Reset()
+			receiver, url := newTestReceiver(t, test.statuses...)
+			n := newNotifier(Notifications{
+				Webhooks: []Webhook{{URL: url, Format: formatJSON, Timeout: time.Second}},
+				Retries:  test.retries,
+				Backoff:  time.Millisecond,
+			})
+
+			n.notify(testEvent(eventListed, time.Now()), testList)
+			n.wait()
+
+			if got := len(receiver.received()); got != test.requests {
+				t.Errorf("received %d requests; want %d", got, test.requests)
+			}
+			result := "failed"
+			if test.delivered {
+				result = "sent"
+			}
+			if got := testutil.ToFloat64(dnsrblNotifications.WithLabelValues("webhook", result)); got != 1 {
+				t.Errorf("dnsrbl_notifications_total{result=%q} = %v; want 1", result, got)
+			}
+
+			// All attempts carry the same ID
+			ids := make(map[string]bool)
+			for _, body := range receiver.received() {
+				var notification Notification
+				json.Unmarshal([]byte(body), &notification)
+				ids[notification.ID] = true
+			}
+			if len(ids) != 1 {
+				t.Errorf("attempts used %d IDs; want 1", len(ids))
+			}
+		})
+	}
+}
+
+func TestNotifierDedup(t *testing.T) {
+	receiver, url := newTestReceiver(t)
+	n := newNotifier(Notifications{Webhooks: []Webhook{{URL: url, Format: formatJSON, Timeout: time.Second}}, DedupWindow: time.Hour})
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	events := []struct {
+		event string
+		after time.Duration
+	}{
+		{eventListed, 0},
+		{eventListed, time.Minute}, // repeated state, suppressed
+		{eventDelisted, 10 * time.Minute},
+		{eventListed, 20 * time.Minute}, // relisting is a change and sent
+		{eventListed, 3 * time.Hour},    // outside the window
+	}
+	for _, event := range events {
+		n.notify(testEvent(event.event, start.Add(event.after)), testList)
+		n.wait()
+	}
+
+	if got := len(receiver.received()); got != 4 {
+		t.Errorf("received %d notifications; want 4", got)
+	}
+}
+
+func TestNotifierInitial(t *testing.T) {
+	for _, notifyInitial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("notify_initial %v", notifyInitial), func(t *testing.T) {
+			receiver, url := newTestReceiver(t)
+			smtp := startFakeSMTP(t, &fakeSMTP{}, nil)
+			n := newNotifier(Notifications{
+				Webhooks:      []Webhook{{URL: url, Format: formatJSON, Timeout: time.Second}},
+				Email:         &Email{Smarthost: smtp.addr(), From: "dnsrbl@example.com", To: []string{"postmaster@example.com"}, TLS: emailTLSNone, Timeout: time.Second},
+				NotifyInitial: notifyInitial,
+			})
+
+			// Listings found on the first check and their delistings are only
+			// sent if enabled
+			start := time.Now()
+			for _, event := range []ListingEvent{testEvent(eventListed, start), testEvent(eventDelisted, start.Add(time.Hour))} {
+				event.Initial = true
+				n.notify(event, testList)
+				n.wait()
+			}
+
+			want := 0
+			if notifyInitial {
+				want = 4
+			}
+			if got := len(receiver.received()) + len(smtp.received()); got != want {
+				t.Errorf("sent %d notifications of an initial listing; want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestNotifierFailedDeliveryNotDeduplicated(t *testing.T) {
+	receiver, url := newTestReceiver(t, 400)
+	n := newNotifier(Notifications{Webhooks: []Webhook{{URL: url, Format: formatJSON, Timeout: time.Second}}, DedupWindow: time.Hour})
+
+	start := time.Now()
+	n.notify(testEvent(eventListed, start), testList)
+	n.wait()
+	n.notify(testEvent(eventListed, start.Add(time.Minute)), testList)
+	n.wait()
+
+	if got := len(receiver.received()); got != 2 {
+		t.Errorf("received %d notifications; want 2", got)
+	}
+}
+
+func TestConfigWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook configWebhook
+		wantErr string
+	}{
+		{"valid", configWebhook{URL: "https://hooks.example.com/x", Timeout: "5s"}, ""},
+		{"template", configWebhook{URL: "http://localhost:9000/", Template: `{"target": {{json .Target}}}`}, ""},
+		{"missing URL", configWebhook{}, "invalid webhook URL"},
+		{"unsupported scheme", configWebhook{URL: "ftp://example.com/"}, "invalid webhook URL"},
+		{"invalid timeout", configWebhook{URL: "https://example.com/", Timeout: "soon"}, "invalid timeout"},
+		{"template syntax", configWebhook{URL: "https://example.com/", Template: `{"target": {{.Target}`}, "invalid template"},
+		{"template without JSON quoting", configWebhook{URL: "https://example.com/", Template: `{"reason": "{{.Reason}}"}`}, "invalid JSON"},
+		{"unknown field", configWebhook{URL: "https://example.com/", Template: `{"x": {{json .Unknown}}}`}, "invalid template"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			webhook, err := test.webhook.toWebhook()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("toWebhook() error = %v", err)
+				}
+				if webhook.Timeout <= 0 {
+					t.Errorf("Timeout = %v", webhook.Timeout)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("toWebhook() error = %v; want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotificationSummary(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		event    ListingEvent
+		expected string
+	}{
+		{testEvent(eventListed, at), "192.0.2.1 is listed in zen.spamhaus.org (sbl): Listed in SBL"},
+		{ListingEvent{Type: eventListed, List: "bl.spamcop.net", Target: "192.0.2.1"}, "192.0.2.1 is listed in bl.spamcop.net"},
+		{testEvent(eventDelisted, at), "192.0.2.1 is no longer listed in zen.spamhaus.org after 1h30m0s"},
+	}
+	for _, test := range tests {
+		if got := newNotification(test.event, testList).Summary(); got != test.expected {
+			t.Errorf("Summary() = %q; want %q", got, test.expected)
+		}
+	}
+
+	if newNotification(testEvent(eventListed, at), testList).ID == newNotification(testEvent(eventListed, at.Add(time.Second)), testList).ID {
+		t.Error("events at different times have the same ID")
+	}
+}
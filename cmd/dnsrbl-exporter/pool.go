@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces events by a minimum interval
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next event is allowed or the context is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkJob is a single check of a target against a list
+type checkJob struct {
+	Target Target
+	List   List
+}
+
+// checkPool runs checks with a bounded number of workers, spacing all
+// queries by a global delay and queries to the same list by a list delay.
+// The workers limit is shared by all runs, e.g. by concurrent probes.
+type checkPool struct {
+	concurrency int
+	slots       chan struct{} // held by the checks in flight
+	global      *rateLimiter
+	listDelay   time.Duration
+
+	mu    sync.Mutex
+	lists map[string]*rateLimiter
+}
+
+func newCheckPool(concurrency int, delay, listDelay time.Duration) *checkPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &checkPool{
+		concurrency: concurrency,
+		slots:       make(chan struct{}, concurrency),
+		global:      &rateLimiter{interval: delay},
+		listDelay:   listDelay,
+		lists:       make(map[string]*rateLimiter),
+	}
+}
+
+// listLimiter returns the rate limiter of a list
+func (p *checkPool) listLimiter(zone string) *rateLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	limiter, ok := p.lists[zone]
+	if !ok {
+		limiter = &rateLimiter{interval: p.listDelay}
+		p.lists[zone] = limiter
+	}
+	return limiter
+}
+
+// run executes all jobs and returns once they are done or the context is done
+func (p *checkPool) run(ctx context.Context, jobs []checkJob, check func(checkJob)) {
+	queue := make(chan checkJob)
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				select {
+				case p.slots <- struct{}{}:
+				case <-ctx.Done():
+					continue
+				}
+				if p.listLimiter(job.List.Zone).wait(ctx) == nil && p.global.wait(ctx) == nil {
+					check(job)
+				}
+				<-p.slots
+			}
+		}()
+	}
+
+feed:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
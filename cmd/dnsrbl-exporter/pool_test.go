@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := &rateLimiter{interval: 20 * time.Millisecond}
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.wait(ctx); err != nil {
+			t.Fatalf("wait() unexpected error: %v", err)
+		}
+	}
+
+	// The first event passes right away, the other three are spaced
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("4 events took %v; want at least %v", elapsed, 60*time.Millisecond)
+	}
+}
+
+func TestRateLimiter_Canceled(t *testing.T) {
+	limiter := &rateLimiter{interval: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	limiter.wait(ctx)
+	cancel()
+	if err := limiter.wait(ctx); err == nil {
+		t.Error("wait() expected error for canceled context but got none")
+	}
+}
+
+func TestCheckPool_Concurrency(t *testing.T) {
+	pool := newCheckPool(3, 0, 0)
+
+	var jobs []checkJob
+	for i := 0; i < 12; i++ {
+		jobs = append(jobs, checkJob{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "bl.example.org"}})
+	}
+
+	var running, maxRunning, done atomic.Int32
+	pool.run(context.Background(), jobs, func(job checkJob) {
+		n := running.Add(1)
+		for {
+			max := maxRunning.Load()
+			if n <= max || maxRunning.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		done.Add(1)
+	})
+
+	if done.Load() != 12 {
+		t.Errorf("done = %d; want %d", done.Load(), 12)
+	}
+	if maxRunning.Load() > 3 {
+		t.Errorf("max concurrent checks = %d; want at most %d", maxRunning.Load(), 3)
+	}
+	if maxRunning.Load() < 2 {
+		t.Errorf("max concurrent checks = %d; want checks to run concurrently", maxRunning.Load())
+	}
+}
+
+func TestCheckPool_SharedConcurrency(t *testing.T) {
+	pool := newCheckPool(2, 0, 0)
+
+	var jobs []checkJob
+	for i := 0; i < 6; i++ {
+		jobs = append(jobs, checkJob{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "bl.example.org"}})
+	}
+
+	// Concurrent runs, e.g. of probes, do not add workers
+	var running, maxRunning atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.run(context.Background(), jobs, func(job checkJob) {
+				n := running.Add(1)
+				for {
+					max := maxRunning.Load()
+					if n <= max || maxRunning.CompareAndSwap(max, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+			})
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning.Load() > 2 {
+		t.Errorf("max concurrent checks of 4 runs = %d; want at most %d", maxRunning.Load(), 2)
+	}
+}
+
+func TestCheckPool_ListDelay(t *testing.T) {
+	pool := newCheckPool(4, 0, 30*time.Millisecond)
+
+	jobs := []checkJob{
+		{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "a.example.org"}},
+		{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "b.example.org"}},
+		{Target: Target{IP: "192.0.2.2"}, List: List{Zone: "a.example.org"}},
+		{Target: Target{IP: "192.0.2.2"}, List: List{Zone: "b.example.org"}},
+	}
+
+	var mu sync.Mutex
+	started := make(map[string][]time.Time)
+	pool.run(context.Background(), jobs, func(job checkJob) {
+		mu.Lock()
+		defer mu.Unlock()
+		started[job.List.Zone] = append(started[job.List.Zone], time.Now())
+	})
+
+	for zone, times := range started {
+		if len(times) != 2 {
+			t.Fatalf("%s checked %d times; want %d", zone, len(times), 2)
+		}
+		gap := times[1].Sub(times[0])
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap < 25*time.Millisecond {
+			t.Errorf("%s queries %v apart; want at least %v", zone, gap, 30*time.Millisecond)
+		}
+	}
+}
+
+func TestCheckPool_Canceled(t *testing.T) {
+	pool := newCheckPool(1, time.Hour, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	jobs := []checkJob{
+		{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "a.example.org"}},
+		{Target: Target{IP: "192.0.2.1"}, List: List{Zone: "b.example.org"}},
+	}
+
+	var done atomic.Int32
+	finished := make(chan struct{})
+	go func() {
+		pool.run(ctx, jobs, func(job checkJob) {
+			done.Add(1)
+			cancel()
+		})
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run() did not return after cancellation")
+	}
+	if done.Load() != 1 {
+		t.Errorf("done = %d; want %d", done.Load(), 1)
+	}
+}
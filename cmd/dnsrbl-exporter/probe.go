@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// defaultProbeTimeout is the timeout of a probe if Prometheus does not send
+// its scrape timeout
+const defaultProbeTimeout = 10 * time.Second
+
+// prober serves /probe requests checking a single target on demand in the
+// style of the blackbox_exporter. Each probe reports into its own registry.
+type prober struct {
+	mu        sync.RWMutex
+	config    *Config
+	resolvers *resolverSet
+	pool      *checkPool
+}
+
+func newProber(config *Config, resolvers *resolverSet, pool *checkPool) *prober {
+	return &prober{config: config, resolvers: resolvers, pool: pool}
+}
+
+// update replaces the configuration used by future probes
+func (p *prober) update(config *Config, resolvers *resolverSet, pool *checkPool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.config, p.resolvers, p.pool = config, resolvers, pool
+}
+
+func (p *prober) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.RLock()
+	config, resolvers, pool := p.config, p.resolvers, p.pool
+	p.mu.RUnlock()
+
+	params := r.URL.Query()
+	target, err := parseProbeTarget(params.Get("target"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lists, err := moduleLists(config.Lists, config.Modules, params.Get("module"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout(r))
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Whether all blacklists answered the probe",
+	})
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "Duration of the probe",
+	})
+	queryDuration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dnsrbl_query_duration_seconds",
+		Help: "Duration of the query of a blacklist",
+	}, []string{"list"})
+	registry.MustRegister(probeSuccess, probeDuration, queryDuration)
+	metrics := newProbeMetrics(registry, target)
+
+	var jobs []checkJob
+	for _, list := range lists {
+		if list.supports(target) {
+			jobs = append(jobs, checkJob{Target: target, List: list})
+		}
+	}
+
+	// Probes share the workers limit and the request delays of the background
+	// checks, lists not queried within the timeout count as failed
+	label := target.String()
+	start := time.Now()
+	var mu sync.Mutex
+	checked, failed, done := 0, 0, 0
+	pool.run(ctx, jobs, func(job checkJob) {
+		result := queryList(ctx, resolvers.forList(job.List), target, job.List)
+
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if result.Result == "" {
+			return
+		}
+		checked++
+		if result.Result != "Found" && result.Result != "NXDOMAIN" {
+			failed++
+		}
+		metrics.record(job.List.Zone, label, result)
+		queryDuration.WithLabelValues(job.List.Zone).Set(result.Duration.Seconds())
+	})
+	failed += len(jobs) - done
+
+	duration := time.Since(start)
+	probeDuration.Set(duration.Seconds())
+	if checked > 0 && failed == 0 {
+		probeSuccess.Set(1)
+	}
+	log.Printf("Probed %s against %d blacklists in %v, %d failed", label, checked, duration, failed)
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// newProbeMetrics registers the result metrics of a probe target, named like
+// the metrics of the background checks
+func newProbeMetrics(registry *prometheus.Registry, target Target) resultMetrics {
+	prefix, targetLabel := "dnsrbl_", "ip"
+	if target.Domain != "" {
+		prefix, targetLabel = "dnsrbl_domain_", "domain"
+	}
+
+	metrics := resultMetrics{
+		targetLabel: targetLabel,
+		status: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "status",
+			Help: "DNSRBL check status: 0=ok, 1=found in blacklist, 2-5=error, 6=refused by blacklist",
+		}, []string{"list", targetLabel}),
+		listed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "listed",
+			Help: "Sub-lists of a blacklist the target is found in",
+		}, []string{"list", targetLabel, "sublist"}),
+		reason: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "listing_reason_info",
+			Help: "Listing reason published by a blacklist as TXT record",
+		}, []string{"list", targetLabel, "reason"}),
+		reasons: newReasonStore(),
+	}
+	registry.MustRegister(metrics.status, metrics.listed, metrics.reason)
+
+	if target.Domain == "" {
+		metrics.lastActivity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "httpbl_last_activity",
+			Help: "ProjectHoneyPot.org last activity",
+		}, []string{"list", "ip"})
+		metrics.threatScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "httpbl_threat_score",
+			Help: "ProjectHoneyPot.org threat score",
+		}, []string{"list", "ip"})
+		metrics.visitorType = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "httpbl_visitor_type",
+			Help: "ProjectHoneyPot.org visitor type",
+		}, []string{"list", "ip"})
+		registry.MustRegister(metrics.lastActivity, metrics.threatScore, metrics.visitorType)
+	}
+
+	return metrics
+}
+
+// parseProbeTarget parses the target of a probe, a single IP address or domain
+func parseProbeTarget(value string) (Target, error) {
+	if value == "" {
+		return Target{}, fmt.Errorf("target parameter is missing")
+	}
+	if strings.Contains(value, "@") {
+		return Target{}, fmt.Errorf("invalid target %q, use the module parameter to select a module", value)
+	}
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return Target{IP: addr.Unmap().WithZone("").String()}, nil
+	}
+
+	targets, err := domainTargets([]string{value})
+	if err != nil {
+		return Target{}, err
+	}
+	return targets[0], nil
+}
+
+// probeTimeout returns the timeout of a probe, slightly below the scrape
+// timeout sent by Prometheus
+func probeTimeout(r *http.Request) time.Duration {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		return defaultProbeTimeout
+	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > time.Second {
+		timeout -= 500 * time.Millisecond
+	}
+	return timeout
+}
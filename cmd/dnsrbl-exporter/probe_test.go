@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestProber(t *testing.T) *prober {
+	t.Helper()
+
+	zone := testDNSZone{
+		"2.0.0.127.bl.example.org":    {"127.0.0.2", "Listed, see https://bl.example.org/lookup"},
+		"example.com.dbl.example.org": {"127.0.1.2"},
+	}
+	address, _ := startTestDNSServer(t, "udp", zone)
+
+	config := &Config{
+		Resolvers:    []string{address},
+		ResolverMode: resolverModeRecursive,
+		Lists: []List{
+			{Zone: "bl.example.org", Type: listTypeIP, IPv4: true},
+			{Zone: "other.example.org", Type: listTypeIP, IPv4: true},
+			{Zone: "dbl.example.org", Type: listTypeDomain},
+		},
+	}
+	resolvers, err := newResolverSet(config)
+	if err != nil {
+		t.Fatalf("newResolverSet() unexpected error: %v", err)
+	}
+	config.Modules = map[string]Module{
+		"web": {Name: "web", Lists: []string{"other.example.org"}},
+	}
+	return newProber(config, resolvers, newCheckPool(1, 0, 0))
+}
+
+func probe(t *testing.T, handler http.Handler, query string) (int, string) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/probe?"+query, nil))
+	body, _ := io.ReadAll(recorder.Body)
+	return recorder.Code, string(body)
+}
+
+func TestProber(t *testing.T) {
+	handler := newTestProber(t)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+		excluded []string
+	}{
+		{
+			name:  "listed IP",
+			query: "target=127.0.0.2",
+			expected: []string{
+				"probe_success 1",
+				`dnsrbl_status{ip="127.0.0.2",list="bl.example.org"} 1`,
+				`dnsrbl_status{ip="127.0.0.2",list="other.example.org"} 0`,
+				`dnsrbl_listed{ip="127.0.0.2",list="bl.example.org",sublist="127.0.0.2"} 1`,
+				`dnsrbl_listing_reason_info{ip="127.0.0.2",list="bl.example.org",reason="Listed, see https://bl.example.org/lookup"} 1`,
+				`dnsrbl_query_duration_seconds{list="bl.example.org"}`,
+			},
+			excluded: []string{"dbl.example.org", "dnsrbl_query{"},
+		},
+		{
+			name:  "clean IP with default module",
+			query: "target=127.0.0.3&module=default",
+			expected: []string{
+				"probe_success 1",
+				`dnsrbl_status{ip="127.0.0.3",list="bl.example.org"} 0`,
+			},
+			excluded: []string{"dnsrbl_listed{"},
+		},
+		{
+			name:  "module",
+			query: "target=127.0.0.2&module=web",
+			expected: []string{
+				"probe_success 1",
+				`dnsrbl_status{ip="127.0.0.2",list="other.example.org"} 0`,
+			},
+			excluded: []string{`list="bl.example.org"`},
+		},
+		{
+			name:  "domain",
+			query: "target=Example.com",
+			expected: []string{
+				"probe_success 1",
+				`dnsrbl_domain_status{domain="example.com",list="dbl.example.org"} 1`,
+				`dnsrbl_domain_listed{domain="example.com",list="dbl.example.org",sublist="127.0.1.2"} 1`,
+			},
+			excluded: []string{`list="bl.example.org"`},
+		},
+		{
+			name:     "no supporting list",
+			query:    "target=2001:db8::1",
+			expected: []string{"probe_success 0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := probe(t, handler, tt.query)
+			if code != http.StatusOK {
+				t.Fatalf("probe(%q) status = %d; want %d", tt.query, code, http.StatusOK)
+			}
+			for _, line := range tt.expected {
+				if !strings.Contains(body, line) {
+					t.Errorf("probe(%q) missing %q in:\n%s", tt.query, line, body)
+				}
+			}
+			for _, line := range tt.excluded {
+				if strings.Contains(body, line) {
+					t.Errorf("probe(%q) unexpectedly contains %q", tt.query, line)
+				}
+			}
+		})
+	}
+}
+
+// slowResolver answers NXDOMAIN after a delay and records the highest number
+// of concurrent queries
+type slowResolver struct {
+	delay time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (r *slowResolver) lookupIP(ctx context.Context, query string) ([]net.IP, error) {
+	r.mu.Lock()
+	r.inFlight++
+	r.peak = max(r.peak, r.inFlight)
+	r.mu.Unlock()
+
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	r.inFlight--
+	r.mu.Unlock()
+	return nil, &net.DNSError{Err: "no such host", Name: query, IsNotFound: true}
+}
+
+func (r *slowResolver) lookupTXT(ctx context.Context, query string) ([]string, error) {
+	return nil, nil
+}
+
+func TestProber_Concurrency(t *testing.T) {
+	resolver := &slowResolver{delay: 10 * time.Millisecond}
+	config := &Config{}
+	resolvers := &resolverSet{lists: make(map[string]lookupResolver)}
+	for i := 0; i < 12; i++ {
+		zone := fmt.Sprintf("bl%d.example.org", i)
+		config.Lists = append(config.Lists, List{Zone: zone, Type: listTypeIP, IPv4: true})
+		resolvers.lists[zone] = resolver
+	}
+
+	// Parallel probes share the workers limit of the pool
+	prober := newProber(config, resolvers, newCheckPool(3, 0, 0))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code, body := probe(t, prober, "target=192.0.2.1"); code != http.StatusOK || !strings.Contains(body, "probe_success 1") {
+				t.Errorf("probe() = %d:\n%s", code, body)
+			}
+		}()
+	}
+	wg.Wait()
+	if resolver.peak > 3 {
+		t.Errorf("peak concurrent queries = %d; want at most 3", resolver.peak)
+	}
+
+	// Lists not queried within the timeout fail the probe
+	pool := newCheckPool(1, 50*time.Millisecond, 0)
+	req := httptest.NewRequest(http.MethodGet, "/probe?target=192.0.2.1", nil)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "0.2")
+	recorder := httptest.NewRecorder()
+	newProber(config, resolvers, pool).ServeHTTP(recorder, req)
+	if body := recorder.Body.String(); !strings.Contains(body, "probe_success 0") {
+		t.Errorf("probe beyond the timeout:\n%s", body)
+	}
+}
+
+func TestProber_InvalidRequest(t *testing.T) {
+	handler := newTestProber(t)
+
+	for _, query := range []string{"", "target=", "target=10.0.0.0/8", "target=127.0.0.2&module=unknown", "target=example.com@web"} {
+		if code, _ := probe(t, handler, query); code != http.StatusBadRequest {
+			t.Errorf("probe(%q) status = %d; want %d", query, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected time.Duration
+	}{
+		{header: "", expected: defaultProbeTimeout},
+		{header: "invalid", expected: defaultProbeTimeout},
+		{header: "15", expected: 14500 * time.Millisecond},
+		{header: "0.5", expected: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/probe", nil)
+		if tt.header != "" {
+			request.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tt.header)
+		}
+		if got := probeTimeout(request); got != tt.expected {
+			t.Errorf("probeTimeout(%q) = %v; want %v", tt.header, got, tt.expected)
+		}
+	}
+}
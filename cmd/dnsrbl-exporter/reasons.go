@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ListingReason is the TXT record a blacklist publishes for a listing
+type ListingReason struct {
+	List    string    `json:"list"`
+	Target  string    `json:"target"`
+	Reason  string    `json:"reason"`
+	Updated time.Time `json:"updated"`
+}
+
+// reasonStore holds the latest listing reason per blacklist and target
+type reasonStore struct {
+	mu      sync.RWMutex
+	reasons map[string]ListingReason
+}
+
+func newReasonStore() *reasonStore {
+	return &reasonStore{reasons: make(map[string]ListingReason)}
+}
+
+var listingReasons = newReasonStore()
+
+func reasonKey(blacklist, target string) string {
+	return blacklist + "|" + target
+}
+
+// set stores the reason of a listing and updates the reason info metric
+func (s *reasonStore) set(vec *prometheus.GaugeVec, targetLabel, blacklist, target, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vec.DeletePartialMatch(prometheus.Labels{"list": blacklist, targetLabel: target})
+	if reason == "" {
+		delete(s.reasons, reasonKey(blacklist, target))
+		return
+	}
+
+	s.reasons[reasonKey(blacklist, target)] = ListingReason{
+		List:    blacklist,
+		Target:  target,
+		Reason:  reason,
+		Updated: time.Now(),
+	}
+	vec.WithLabelValues(blacklist, target, reason).Set(1)
+}
+
+// all returns all stored reasons ordered by list and target
+func (s *reasonStore) all() []ListingReason {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reasons := make([]ListingReason, 0, len(s.reasons))
+	for _, reason := range s.reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].List != reasons[j].List {
+			return reasons[i].List < reasons[j].List
+		}
+		return reasons[i].Target < reasons[j].Target
+	})
+	return reasons
+}
+
+// reasonsHandler serves all listing reasons as JSON
+func reasonsHandler(store *reasonStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(store.all()); err != nil {
+			log.Printf("Failed to encode listing reasons: %v", err)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReasonStore(t *testing.T) {
+	store := newReasonStore()
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_reason_info"}, []string{"list", "ip", "reason"})
+
+	store.set(vec, "ip", "zen.spamhaus.org", "192.0.2.1", "https://check.spamhaus.org/query/ip/192.0.2.1")
+	store.set(vec, "ip", "bl.spamcop.net", "192.0.2.1", "Blocked - see https://www.spamcop.net/bl.shtml?192.0.2.1")
+
+	reasons := store.all()
+	if len(reasons) != 2 {
+		t.Fatalf("all() returned %d reasons; want %d", len(reasons), 2)
+	}
+	if reasons[0].List != "bl.spamcop.net" || reasons[1].List != "zen.spamhaus.org" {
+		t.Errorf("all() not ordered by list: %+v", reasons)
+	}
+	if got := testutil.CollectAndCount(vec); got != 2 {
+		t.Errorf("series count = %d; want %d", got, 2)
+	}
+
+	// A changed reason replaces the previous series
+	store.set(vec, "ip", "zen.spamhaus.org", "192.0.2.1", "changed")
+	if got := testutil.CollectAndCount(vec); got != 2 {
+		t.Errorf("series count after change = %d; want %d", got, 2)
+	}
+
+	// An empty reason removes the listing
+	store.set(vec, "ip", "zen.spamhaus.org", "192.0.2.1", "")
+	if got := len(store.all()); got != 1 {
+		t.Errorf("all() after delisting returned %d reasons; want %d", got, 1)
+	}
+	if got := testutil.CollectAndCount(vec); got != 1 {
+		t.Errorf("series count after delisting = %d; want %d", got, 1)
+	}
+}
+
+func TestReasonsHandler(t *testing.T) {
+	store := newReasonStore()
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_handler_reason_info"}, []string{"list", "ip", "reason"})
+	store.set(vec, "ip", "zen.spamhaus.org", "192.0.2.1", "listed")
+
+	rec := httptest.NewRecorder()
+	reasonsHandler(store).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/reasons", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q; want %q", ct, "application/json")
+	}
+
+	var reasons []ListingReason
+	if err := json.NewDecoder(rec.Body).Decode(&reasons); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(reasons) != 1 || reasons[0].Target != "192.0.2.1" || reasons[0].Reason != "listed" {
+		t.Errorf("response = %+v", reasons)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// configWatchInterval is the interval in which watched files are checked for changes
+const configWatchInterval = 10 * time.Second
+
+// configWatcher detects changes of the files a configuration was read from.
+// Files are compared by checksum, so that updates replacing a file or a
+// symlink, such as Kubernetes ConfigMap updates, are detected as well.
+type configWatcher struct {
+	mu   sync.Mutex
+	sums map[string][sha256.Size]byte
+}
+
+func newConfigWatcher(files []string) *configWatcher {
+	w := &configWatcher{}
+	w.watch(files)
+	return w
+}
+
+// watch replaces the watched files and records their current checksums
+func (w *configWatcher) watch(files []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sums = make(map[string][sha256.Size]byte, len(files))
+	for _, filename := range files {
+		w.sums[filename] = fileChecksum(filename)
+	}
+}
+
+// changed reports whether any watched file changed since the last call
+func (w *configWatcher) changed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := false
+	for filename, sum := range w.sums {
+		if current := fileChecksum(filename); current != sum {
+			w.sums[filename] = current
+			changed = true
+		}
+	}
+	return changed
+}
+
+// fileChecksum returns the checksum of a file, or the zero checksum if the
+// file cannot be read
+func fileChecksum(filename string) [sha256.Size]byte {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(data)
+}
+
+// updateLists sets the series of the configured lists and deletes those of
+// previous lists no longer configured, whether or not they were checked
+func updateLists(lists, previous []List) {
+	dnsrblListSize.Set(float64(len(lists)))
+
+	current := make(map[string]bool, len(lists))
+	for _, list := range lists {
+		current[list.Zone] = true
+		dnsrblListInfo.DeletePartialMatch(prometheus.Labels{"list": list.Zone})
+		dnsrblListInfo.WithLabelValues(list.Zone, list.displayName(), list.Type, list.Homepage, list.DelistURL).Set(1)
+		dnsrblListSeverity.WithLabelValues(list.Zone).Set(list.Severity)
+	}
+
+	for _, list := range previous {
+		if current[list.Zone] {
+			continue
+		}
+		dnsrblListInfo.DeletePartialMatch(prometheus.Labels{"list": list.Zone})
+		dnsrblListSeverity.DeleteLabelValues(list.Zone)
+		dnsrblCIDRListed.DeletePartialMatch(prometheus.Labels{"list": list.Zone})
+		dnsrblListingEvents.DeletePartialMatch(prometheus.Labels{"list": list.Zone})
+	}
+}
+
+// deleteSeries deletes the series of (list, target) pairs no longer checked.
+// Series of targets are deleted once no remaining pair uses them.
+func deleteSeries(removed []checkJob, targets []Target, cidrs *cidrTracker) {
+	currentTargets := make(map[string]bool)
+	currentCIDRs := make(map[string]bool)
+	for _, target := range targets {
+		currentTargets[target.String()] = true
+		if target.CIDR != "" {
+			currentCIDRs[target.CIDR] = true
+		}
+	}
+	for _, job := range removed {
+		target := job.Target.String()
+		dnsrblNextCheck.Delete(pairLabels(job.List.Zone, target))
+		dnsrblLastCheck.Delete(pairLabels(job.List.Zone, target))
+		checkResults.delete(job.List.Zone, target)
+		listingEvents.forget(job.List.Zone, target)
+
+		if job.Target.Domain != "" {
+			labels := prometheus.Labels{"list": job.List.Zone, "domain": target}
+			dnsrblDomainQuery.DeletePartialMatch(labels)
+			dnsrblDomainStatus.DeletePartialMatch(labels)
+			dnsrblDomainListed.DeletePartialMatch(labels)
+			listingReasons.set(dnsrblDomainListingReason, "domain", job.List.Zone, target, "")
+		} else {
+			labels := prometheus.Labels{"list": job.List.Zone, "ip": target}
+			dnsrblQuery.DeletePartialMatch(labels)
+			dnsrblStatus.DeletePartialMatch(labels)
+			dnsrblListed.DeletePartialMatch(labels)
+			httpblLastActivity.DeletePartialMatch(labels)
+			httpblThreatScore.DeletePartialMatch(labels)
+			httpblVisitorType.DeletePartialMatch(labels)
+			listingReasons.set(dnsrblListingReason, "ip", job.List.Zone, target, "")
+			cidrs.update(job.Target, job.List.Zone, false)
+		}
+
+		if !currentTargets[target] {
+			dnsrblTaskState.DeleteLabelValues(target)
+			dnsrblLastRun.DeleteLabelValues(target)
+		}
+		if job.Target.CIDR != "" && !currentCIDRs[job.Target.CIDR] {
+			cidrs.remove(job.Target.CIDR)
+		}
+	}
+}
+
+// watchReloads requests a reload on SIGHUP or when a watched file changes
+func watchReloads(watcher *configWatcher, reloads chan<- string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		var reason string
+		select {
+		case <-signals:
+			reason = "SIGHUP"
+		case <-ticker.C:
+			if !watcher.changed() {
+				continue
+			}
+			reason = "file change"
+		}
+
+		// Drop the request if a reload is already pending
+		select {
+		case reloads <- reason:
+		default:
+		}
+	}
+}
+
+// reloadConfig loads the configuration and creates its resolvers
+func reloadConfig(filename string) (*Config, *resolverSet, error) {
+	config, err := loadConfig(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolvers, err := newResolverSet(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, resolvers, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConfigWatcher(t *testing.T) {
+	filename := writeTestFile(t, "lists.txt", "zen.spamhaus.org\n")
+	watcher := newConfigWatcher([]string{filename})
+
+	if watcher.changed() {
+		t.Error("changed() = true for an unchanged file")
+	}
+
+	if err := os.WriteFile(filename, []byte("zen.spamhaus.org\nbl.spamcop.net\n"), 0644); err != nil {
+		t.Fatalf("Failed to update file: %v", err)
+	}
+	if !watcher.changed() {
+		t.Error("changed() = false after the file was updated")
+	}
+	if watcher.changed() {
+		t.Error("changed() = true twice for the same update")
+	}
+
+	if err := os.Remove(filename); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if !watcher.changed() {
+		t.Error("changed() = false after the file was removed")
+	}
+
+	watcher.watch(nil)
+	if err := os.WriteFile(filename, []byte("bl.spamcop.net\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if watcher.changed() {
+		t.Error("changed() = true for a file no longer watched")
+	}
+}
+
+func TestDeleteSeries(t *testing.T) {
+	kept := Target{IP: "192.0.2.1"}
+	removedIP := Target{IP: "198.51.100.1", CIDR: "198.51.100.0/30"}
+	removedDomain := Target{Domain: "example.com"}
+	spamcop := List{Zone: "bl.spamcop.net", Type: listTypeIP, IPv4: true}
+	spamhaus := List{Zone: "zen.spamhaus.org", Type: listTypeIP, IPv4: true}
+	dbl := List{Zone: "dbl.spamhaus.org", Type: listTypeDomain}
+
+	vecs := []*prometheus.GaugeVec{dnsrblStatus, dnsrblListed, dnsrblTaskState, dnsrblListSeverity, dnsrblDomainStatus, dnsrblCIDRSize, dnsrblCIDRListed}
+	reset := func() {
+		for _, vec := range vecs {
+			vec.Reset()
+		}
+	}
+	reset()
+	defer reset()
+
+	for _, target := range []Target{kept, removedIP} {
+		for _, list := range []List{spamcop, spamhaus} {
+			dnsrblStatus.WithLabelValues(list.Zone, target.IP).Set(1)
+			dnsrblListed.WithLabelValues(list.Zone, target.IP, "127.0.0.2").Set(1)
+		}
+		dnsrblTaskState.WithLabelValues(target.IP).Set(0)
+	}
+	dnsrblListSeverity.WithLabelValues(spamhaus.Zone).Set(1)
+	dnsrblListSeverity.WithLabelValues(spamcop.Zone).Set(1)
+	dnsrblDomainStatus.WithLabelValues(dbl.Zone, removedDomain.Domain).Set(1)
+	dnsrblCIDRSize.WithLabelValues(removedIP.CIDR).Set(4)
+	cidrs := newCIDRTracker()
+	cidrs.update(removedIP, spamcop.Zone, true)
+
+	// The second address, the domain and the Spamhaus list are removed
+	removed := []checkJob{
+		{Target: kept, List: spamhaus},
+		{Target: removedIP, List: spamcop},
+		{Target: removedIP, List: spamhaus},
+		{Target: removedDomain, List: dbl},
+	}
+	deleteSeries(removed, []Target{kept}, cidrs)
+	updateLists([]List{spamcop, dbl}, []List{spamcop, spamhaus, dbl})
+
+	if got := testutil.CollectAndCount(dnsrblStatus); got != 1 {
+		t.Errorf("dnsrbl_status series = %d; want 1", got)
+	}
+	if got := testutil.ToFloat64(dnsrblStatus.WithLabelValues(spamcop.Zone, kept.IP)); got != 1 {
+		t.Errorf("dnsrbl_status of the kept pair = %v; want 1", got)
+	}
+	if got := testutil.CollectAndCount(dnsrblListed); got != 1 {
+		t.Errorf("dnsrbl_listed series = %d; want 1", got)
+	}
+	if got := testutil.CollectAndCount(dnsrblTaskState); got != 1 {
+		t.Errorf("dnsrbl_task_state series = %d; want 1", got)
+	}
+	if got := testutil.CollectAndCount(dnsrblListSeverity); got != 2 {
+		t.Errorf("dnsrbl_list_severity series = %d; want 2", got)
+	}
+	if got := testutil.CollectAndCount(dnsrblDomainStatus); got != 0 {
+		t.Errorf("dnsrbl_domain_status series = %d; want 0", got)
+	}
+	if got := testutil.CollectAndCount(dnsrblCIDRSize) + testutil.CollectAndCount(dnsrblCIDRListed); got != 0 {
+		t.Errorf("CIDR series = %d; want 0", got)
+	}
+	if got := cidrs.count(removedIP.CIDR, spamcop.Zone); got != 0 {
+		t.Errorf("cidrs.count() = %d; want 0", got)
+	}
+}
+
+func TestUpdateLists(t *testing.T) {
+	dnsrblListInfo.Reset()
+	dnsrblListSeverity.Reset()
+	defer dnsrblListInfo.Reset()
+	defer dnsrblListSeverity.Reset()
+
+	spamcop := List{Zone: "bl.spamcop.net", Type: listTypeIP, IPv4: true, Severity: 1}
+	dbl := List{Zone: "dbl.spamhaus.org", Type: listTypeDomain, Severity: 5}
+	v6 := List{Zone: "v6.example.org", Type: listTypeIP, IPv6: true, Severity: 1}
+
+	// Lists without checks, such as domain lists with only IP targets, have list series too
+	updateLists([]List{spamcop, dbl, v6}, nil)
+	if got := testutil.CollectAndCount(dnsrblListSeverity); got != 3 {
+		t.Fatalf("dnsrbl_list_severity series = %d; want 3", got)
+	}
+	if got := testutil.ToFloat64(dnsrblListSize); got != 3 {
+		t.Errorf("dnsrbl_list_size = %v; want 3", got)
+	}
+
+	// Removed lists are deleted whether or not they were checked
+	updateLists([]List{spamcop}, []List{spamcop, dbl, v6})
+	if got := testutil.CollectAndCount(dnsrblListSeverity); got != 1 {
+		t.Errorf("dnsrbl_list_severity series = %d; want 1", got)
+	}
+	if got := testutil.CollectAndCount(dnsrblListInfo); got != 1 {
+		t.Errorf("dnsrbl_list_info series = %d; want 1", got)
+	}
+}
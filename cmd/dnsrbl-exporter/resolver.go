@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// resolverServer is an upstream DNS server and the protocol used to reach it
+type resolverServer struct {
+	Network string
+	Address string
+}
+
+// parseResolver parses a resolver address of the form "host", "host:port"
+// or "protocol://host:port". Supported protocols are udp, tcp, tls for
+// DNS-over-TLS (RFC 7858) and https for DNS-over-HTTPS (RFC 8484), which
+// takes a URL such as "https://dns.example.com/dns-query".
+func parseResolver(value string) (resolverServer, error) {
+	network := "udp"
+	address := value
+	if scheme, rest, ok := strings.Cut(value, "://"); ok {
+		network = strings.ToLower(scheme)
+		address = rest
+	}
+
+	port := "53"
+	switch network {
+	case "udp", "tcp":
+	case "tls":
+		port = "853"
+	case "https":
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			return resolverServer{}, fmt.Errorf("invalid resolver %q: invalid URL", value)
+		}
+		return resolverServer{Network: network, Address: u.String()}, nil
+	default:
+		return resolverServer{}, fmt.Errorf("invalid resolver %q: unsupported protocol %q", value, network)
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(strings.Trim(address, "[]"), port)
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return resolverServer{}, fmt.Errorf("invalid resolver %q: missing host", value)
+	}
+
+	return resolverServer{Network: network, Address: address}, nil
+}
+
+// dnsResolver resolves blacklist queries through the system resolver or
+// through explicitly configured upstream servers
+type dnsResolver struct {
+	servers  []resolverServer
+	next     atomic.Uint32
+	resolver *net.Resolver
+
+	// TLS and HTTP settings of DNS-over-TLS and DNS-over-HTTPS servers,
+	// defaults are used if nil
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+}
+
+// newResolver creates a resolver for the given upstream servers. Without
+// servers the system resolver is used.
+func newResolver(addresses []string) (*dnsResolver, error) {
+	r := &dnsResolver{resolver: &net.Resolver{}}
+	for _, address := range addresses {
+		server, err := parseResolver(address)
+		if err != nil {
+			return nil, err
+		}
+		r.servers = append(r.servers, server)
+	}
+
+	if len(r.servers) > 0 {
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial:     r.dial,
+		}
+	}
+
+	return r, nil
+}
+
+// dial connects to the next upstream server, rotating across all servers so
+// that retries of the Go resolver fail over to another server
+func (r *dnsResolver) dial(ctx context.Context, network, _ string) (net.Conn, error) {
+	server := r.servers[int(r.next.Add(1)-1)%len(r.servers)]
+
+	var d net.Dialer
+	switch server.Network {
+	case "tcp":
+		return d.DialContext(ctx, "tcp", server.Address)
+	case "tls":
+		// Connections which are no net.PacketConn are used with TCP framing
+		// by the Go resolver, which is what DNS-over-TLS expects
+		host, _, _ := net.SplitHostPort(server.Address)
+		config := &tls.Config{ServerName: host}
+		if r.tlsConfig != nil {
+			config = r.tlsConfig.Clone()
+			config.ServerName = host
+		}
+		dialer := &tls.Dialer{NetDialer: &d, Config: config}
+		return dialer.DialContext(ctx, "tcp", server.Address)
+	case "https":
+		client := r.httpClient
+		if client == nil {
+			client = http.DefaultClient
+		}
+		return &dohConn{ctx: ctx, url: server.Address, client: client}, nil
+	default:
+		// The Go resolver retries truncated UDP answers over TCP
+		return d.DialContext(ctx, network, server.Address)
+	}
+}
+
+// lookupIP resolves the A records of a query. DNSBL answers are always A records,
+// even for IPv6 queries (RFC 5782 section 2.4).
+func (r *dnsResolver) lookupIP(ctx context.Context, query string) ([]net.IP, error) {
+	return r.resolver.LookupIP(ctx, "ip4", fqdn(query))
+}
+
+// lookupTXT resolves the TXT records of a query
+func (r *dnsResolver) lookupTXT(ctx context.Context, query string) ([]string, error) {
+	return r.resolver.LookupTXT(ctx, fqdn(query))
+}
+
+// fqdn returns a name with a trailing dot. Such names are queried as given,
+// without trying the search domains of resolv.conf, which would send e.g.
+// cluster.local names to public resolvers and multiply queries of a listing.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// lookupResolver resolves blacklist queries
+type lookupResolver interface {
+	lookupIP(ctx context.Context, query string) ([]net.IP, error)
+	lookupTXT(ctx context.Context, query string) ([]string, error)
+}
+
+// Resolver modes
+const (
+	resolverModeRecursive     = "recursive"
+	resolverModeAuthoritative = "authoritative"
+)
+
+// resolverSet holds the default resolver and the resolvers of lists
+// overriding it or querying authoritative nameservers
+type resolverSet struct {
+	defaultResolver *dnsResolver
+	lists           map[string]lookupResolver
+}
+
+// newResolverSet creates the resolvers for the configuration
+func newResolverSet(config *Config) (*resolverSet, error) {
+	defaultResolver, err := newResolver(config.Resolvers)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &resolverSet{
+		defaultResolver: defaultResolver,
+		lists:           make(map[string]lookupResolver),
+	}
+	for _, list := range config.Lists {
+		recursive := defaultResolver
+		if len(list.Resolvers) > 0 {
+			if recursive, err = newResolver(list.Resolvers); err != nil {
+				return nil, fmt.Errorf("list %s: %w", list.Zone, err)
+			}
+			set.lists[list.Zone] = recursive
+		}
+
+		if list.Authoritative || config.ResolverMode == resolverModeAuthoritative {
+			set.lists[list.Zone] = newAuthoritativeResolver(list.Zone, recursive)
+		}
+	}
+
+	return set, nil
+}
+
+// forList returns the resolver to be used for a list
+func (s *resolverSet) forList(list List) lookupResolver {
+	if r, ok := s.lists[list.Zone]; ok {
+		return r
+	}
+	return s.defaultResolver
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testDNSZone maps query names without trailing dot to A, TXT and NS records,
+// the latter prefixed with "ns:". Names not in the zone are answered with NXDOMAIN.
+type testDNSZone map[string][]string
+
+// answer builds the DNS response for a raw query
+func (z testDNSZone) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(question.Name.String()), ".")
+	records, ok := z[name]
+	if !ok {
+		return z.rcode(header.ID, question, dnsmessage.RCodeNameError)
+	}
+
+	resource := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	for _, record := range records {
+		ip := net.ParseIP(record).To4()
+		nameserver, isNS := strings.CutPrefix(record, "ns:")
+		switch {
+		case question.Type == dnsmessage.TypeNS && isNS:
+			err = builder.NSResource(resource, dnsmessage.NSResource{NS: dnsmessage.MustNewName(nameserver + ".")})
+		case question.Type == dnsmessage.TypeA && ip != nil:
+			err = builder.AResource(resource, dnsmessage.AResource{A: [4]byte(ip)})
+		case question.Type == dnsmessage.TypeTXT && ip == nil && !isNS:
+			err = builder.TXTResource(resource, dnsmessage.TXTResource{TXT: []string{record}})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.Finish()
+}
+
+func (z testDNSZone) rcode(id uint16, question dnsmessage.Question, rcode dnsmessage.RCode) ([]byte, error) {
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, Response: true, Authoritative: true, RCode: rcode},
+		Questions: []dnsmessage.Question{question},
+	}
+	return msg.Pack()
+}
+
+// startTestDNSServer serves a zone over UDP or TCP on a random local port and
+// returns its address and a counter of received queries
+func startTestDNSServer(t *testing.T, network string, zone testDNSZone) (string, *atomic.Int32) {
+	t.Helper()
+
+	var queries atomic.Int32
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		go func() {
+			buf := make([]byte, 512)
+			for {
+				n, addr, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				queries.Add(1)
+				if response, err := zone.answer(buf[:n]); err == nil {
+					conn.WriteTo(response, addr)
+				}
+			}
+		}()
+		return conn.LocalAddr().String(), &queries
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestDNSStream(conn, zone, &queries)
+		}
+	}()
+	return listener.Addr().String(), &queries
+}
+
+// serveTestDNSStream answers length prefixed queries on a stream connection
+func serveTestDNSStream(conn net.Conn, zone testDNSZone, queries *atomic.Int32) {
+	defer conn.Close()
+	for {
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		queries.Add(1)
+
+		response, err := zone.answer(query)
+		if err != nil {
+			return
+		}
+		if err := binary.Write(conn, binary.BigEndian, uint16(len(response))); err != nil {
+			return
+		}
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+// startRecordingDNSServer serves a zone over UDP and returns its address and
+// a function returning the names of all received questions
+func startRecordingDNSServer(t *testing.T, zone testDNSZone) (string, func() []string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var mu sync.Mutex
+	var names []string
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var parser dnsmessage.Parser
+			if _, err := parser.Start(buf[:n]); err != nil {
+				continue
+			}
+			if question, err := parser.Question(); err == nil {
+				mu.Lock()
+				names = append(names, question.Name.String())
+				mu.Unlock()
+			}
+			if response, err := zone.answer(buf[:n]); err == nil {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), names...)
+	}
+}
+
+func TestParseResolver(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    resolverServer
+		shouldError bool
+	}{
+		{name: "host only", input: "1.1.1.1", expected: resolverServer{Network: "udp", Address: "1.1.1.1:53"}},
+		{name: "host and port", input: "1.1.1.1:5353", expected: resolverServer{Network: "udp", Address: "1.1.1.1:5353"}},
+		{name: "tcp", input: "tcp://9.9.9.9", expected: resolverServer{Network: "tcp", Address: "9.9.9.9:53"}},
+		{name: "IPv6", input: "2001:db8::1", expected: resolverServer{Network: "udp", Address: "[2001:db8::1]:53"}},
+		{name: "IPv6 with port", input: "udp://[2001:db8::1]:5353", expected: resolverServer{Network: "udp", Address: "[2001:db8::1]:5353"}},
+		{name: "hostname", input: "tcp://resolver.example.com:53", expected: resolverServer{Network: "tcp", Address: "resolver.example.com:53"}},
+		{name: "tls", input: "tls://1.1.1.1", expected: resolverServer{Network: "tls", Address: "1.1.1.1:853"}},
+		{name: "https", input: "https://dns.example.com/dns-query", expected: resolverServer{Network: "https", Address: "https://dns.example.com/dns-query"}},
+		{name: "https without host", input: "https:///dns-query", shouldError: true},
+		{name: "unsupported protocol", input: "quic://1.1.1.1", shouldError: true},
+		{name: "missing host", input: "udp://:53", shouldError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseResolver(tt.input)
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("parseResolver(%q) expected error but got none", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseResolver(%q) unexpected error: %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("parseResolver(%q) = %+v; want %+v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolver_Upstream(t *testing.T) {
+	zone := testDNSZone{
+		"2.0.0.127.bl.example.org": {"127.0.0.2", "Listed, see https://bl.example.org/lookup"},
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			address, queries := startTestDNSServer(t, network, zone)
+			resolver, err := newResolver([]string{network + "://" + address})
+			if err != nil {
+				t.Fatalf("newResolver() unexpected error: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			ips, err := resolver.lookupIP(ctx, "2.0.0.127.bl.example.org.")
+			if err != nil {
+				t.Fatalf("lookupIP() unexpected error: %v", err)
+			}
+			if len(ips) != 1 || ips[0].String() != "127.0.0.2" {
+				t.Errorf("lookupIP() = %v; want [127.0.0.2]", ips)
+			}
+
+			txt, err := resolver.lookupTXT(ctx, "2.0.0.127.bl.example.org.")
+			if err != nil {
+				t.Fatalf("lookupTXT() unexpected error: %v", err)
+			}
+			if len(txt) != 1 || txt[0] != "Listed, see https://bl.example.org/lookup" {
+				t.Errorf("lookupTXT() = %q", txt)
+			}
+
+			_, err = resolver.lookupIP(ctx, "1.0.0.127.bl.example.org.")
+			if result := classifyDNSError(err); result != "NXDOMAIN" {
+				t.Errorf("lookupIP() of unlisted IP = %q (%v); want NXDOMAIN", result, err)
+			}
+
+			if queries.Load() == 0 {
+				t.Error("upstream server received no queries")
+			}
+		})
+	}
+}
+
+func TestResolver_TLS(t *testing.T) {
+	zone := testDNSZone{"2.0.0.127.bl.example.org": {"127.0.0.2"}}
+
+	// Borrow the certificate of a test HTTPS server for the DNS-over-TLS server
+	https := httptest.NewTLSServer(http.NotFoundHandler())
+	defer https.Close()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: https.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	var queries atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestDNSStream(conn, zone, &queries)
+		}
+	}()
+
+	resolver, err := newResolver([]string{"tls://" + listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("newResolver() unexpected error: %v", err)
+	}
+	resolver.tlsConfig = https.Client().Transport.(*http.Transport).TLSClientConfig
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips, err := resolver.lookupIP(ctx, "2.0.0.127.bl.example.org.")
+	if err != nil {
+		t.Fatalf("lookupIP() unexpected error: %v", err)
+	}
+	if len(ips) != 1 || ips[0].String() != "127.0.0.2" {
+		t.Errorf("lookupIP() = %v; want [127.0.0.2]", ips)
+	}
+
+	_, err = resolver.lookupIP(ctx, "1.0.0.127.bl.example.org.")
+	if result := classifyDNSError(err); result != "NXDOMAIN" {
+		t.Errorf("lookupIP() of unlisted IP = %q (%v); want NXDOMAIN", result, err)
+	}
+
+	// The server certificate must be verified
+	resolver.tlsConfig = nil
+	if _, err := resolver.lookupIP(ctx, "2.0.0.127.bl.example.org."); err == nil {
+		t.Error("lookupIP() with untrusted certificate expected error but got none")
+	}
+}
+
+func TestResolverSet_ListOverride(t *testing.T) {
+	defaultAddress, defaultQueries := startTestDNSServer(t, "udp", testDNSZone{})
+	listAddress, listQueries := startTestDNSServer(t, "udp", testDNSZone{})
+
+	config := &Config{
+		Resolvers: []string{defaultAddress},
+		Lists: []List{
+			{Zone: "bl.example.org", Type: listTypeIP, IPv4: true},
+			{Zone: "dqs.example.org", Type: listTypeIP, IPv4: true, Resolvers: []string{listAddress}},
+		},
+	}
+	set, err := newResolverSet(config)
+	if err != nil {
+		t.Fatalf("newResolverSet() unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set.forList(config.Lists[0]).lookupIP(ctx, "2.0.0.127.bl.example.org.")
+	if defaultQueries.Load() == 0 || listQueries.Load() != 0 {
+		t.Errorf("default list queries: default=%d list=%d", defaultQueries.Load(), listQueries.Load())
+	}
+
+	set.forList(config.Lists[1]).lookupIP(ctx, "2.0.0.127.dqs.example.org.")
+	if listQueries.Load() == 0 {
+		t.Error("list resolver received no queries")
+	}
+}
+
+func TestResolver_SearchDomains(t *testing.T) {
+	address, questions := startRecordingDNSServer(t, testDNSZone{})
+	resolver, err := newResolver([]string{address})
+	if err != nil {
+		t.Fatalf("newResolver() unexpected error: %v", err)
+	}
+
+	// Only the queried names are sent, also without trailing dot, and no names
+	// with search domains of resolv.conf such as default.svc.cluster.local
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := resolver.lookupIP(ctx, "2.0.0.127.bl.example.org."); err == nil {
+		t.Error("lookupIP() expected NXDOMAIN")
+	}
+	if _, err := resolver.lookupTXT(ctx, "2.0.0.127.bl.example.org"); err == nil {
+		t.Error("lookupTXT() expected NXDOMAIN")
+	}
+
+	want := []string{"2.0.0.127.bl.example.org.", "2.0.0.127.bl.example.org."}
+	if got := questions(); !slices.Equal(got, want) {
+		t.Errorf("questions = %v; want %v", got, want)
+	}
+}
+
+func TestResolver_System(t *testing.T) {
+	resolver, err := newResolver(nil)
+	if err != nil {
+		t.Fatalf("newResolver() unexpected error: %v", err)
+	}
+
+	// Test with a known good DNS query (Google's public DNS)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips, err := resolver.lookupIP(ctx, "google.com")
+	if err != nil {
+		t.Logf("lookupIP failed (this may be expected in some environments): %v", err)
+	}
+	if len(ips) == 0 && err == nil {
+		t.Error("lookupIP returned no IPs and no error")
+	}
+}
+
+func TestResolver_Timeout(t *testing.T) {
+	resolver, err := newResolver(nil)
+	if err != nil {
+		t.Fatalf("newResolver() unexpected error: %v", err)
+	}
+
+	// Create a context with very short timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Nanosecond)
+	defer cancel()
+
+	// This should timeout or fail quickly
+	_, err = resolver.lookupIP(ctx, "test.invalid.blacklist.example.com")
+	if err == nil {
+		t.Log("Expected timeout error but got none (may be cached)")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CheckStatus is the latest result of a check of a target against a blacklist
+type CheckStatus struct {
+	List     string    `json:"list"`
+	Target   string    `json:"target"`
+	Module   string    `json:"module,omitempty"`
+	Result   string    `json:"result"`
+	Listed   bool      `json:"listed"`
+	Answers  []string  `json:"answers,omitempty"`
+	Sublists []string  `json:"sublists,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Latency  float64   `json:"latency_seconds"`
+	Checked  time.Time `json:"checked"`
+	Restored bool      `json:"restored,omitempty"` // Restored from the state file, not checked since the restart
+}
+
+// StatusSummary counts the latest results
+type StatusSummary struct {
+	Targets int `json:"targets"`
+	Lists   int `json:"lists"`
+	Checks  int `json:"checks"`
+	Listed  int `json:"listed"`
+	Errors  int `json:"errors"`
+}
+
+// resultStore holds the latest check result per blacklist and target,
+// optionally persisted in a state file
+type resultStore struct {
+	mu      sync.RWMutex
+	results map[string]CheckStatus
+	state   *stateStore
+}
+
+func newResultStore() *resultStore {
+	return &resultStore{results: make(map[string]CheckStatus)}
+}
+
+var checkResults = newResultStore()
+
+// persist writes all future changes to a state file
+func (s *resultStore) persist(state *stateStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = state
+}
+
+// set stores the result of a check
+func (s *resultStore) set(job checkJob, result checkResult, checked time.Time) {
+	status := CheckStatus{
+		List:     job.List.Zone,
+		Target:   job.Target.String(),
+		Module:   job.Target.Module,
+		Result:   result.Result,
+		Listed:   result.Result == "Found",
+		Answers:  result.Answers,
+		Sublists: result.Sublists,
+		Reason:   result.Reason,
+		Latency:  result.Duration.Seconds(),
+		Checked:  checked,
+	}
+
+	s.mu.Lock()
+	s.results[reasonKey(status.List, status.Target)] = status
+	state := s.state
+	s.mu.Unlock()
+
+	if state != nil {
+		if err := state.save(status); err != nil {
+			log.Printf("Failed to save state of %s on %s: %v", status.Target, status.List, err)
+		}
+	}
+}
+
+// restore stores a result restored from the state file
+func (s *resultStore) restore(status CheckStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status.Restored = true
+	s.results[reasonKey(status.List, status.Target)] = status
+}
+
+// delete removes the result of a blacklist and target
+func (s *resultStore) delete(blacklist, target string) {
+	s.mu.Lock()
+	delete(s.results, reasonKey(blacklist, target))
+	state := s.state
+	s.mu.Unlock()
+
+	if state != nil {
+		if err := state.delete(blacklist, target); err != nil {
+			log.Printf("Failed to delete state of %s on %s: %v", target, blacklist, err)
+		}
+	}
+}
+
+// filter returns the stored results matching a filter ordered by target and list
+func (s *resultStore) filter(match func(CheckStatus) bool) []CheckStatus {
+	s.mu.RLock()
+	results := make([]CheckStatus, 0, len(s.results))
+	for _, result := range s.results {
+		if match(result) {
+			results = append(results, result)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Target != results[j].Target {
+			return results[i].Target < results[j].Target
+		}
+		return results[i].List < results[j].List
+	})
+	return results
+}
+
+// all returns all stored results ordered by target and list
+func (s *resultStore) all() []CheckStatus {
+	return s.filter(func(CheckStatus) bool { return true })
+}
+
+// summarize counts the targets, lists, listings and errors of results
+func summarize(results []CheckStatus) StatusSummary {
+	targets := make(map[string]bool)
+	lists := make(map[string]bool)
+	summary := StatusSummary{Checks: len(results)}
+	for _, result := range results {
+		targets[result.Target] = true
+		lists[result.List] = true
+		switch result.Result {
+		case "Found":
+			summary.Listed++
+		case "NXDOMAIN":
+		default:
+			summary.Errors++
+		}
+	}
+	summary.Targets = len(targets)
+	summary.Lists = len(lists)
+	return summary
+}
+
+// statusHandler serves the latest results of all checks at /api/v1/status
+func statusHandler(store *resultStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results := store.all()
+		writeJSON(w, http.StatusOK, struct {
+			Summary StatusSummary `json:"summary"`
+			Results []CheckStatus `json:"results"`
+		}{summarize(results), results})
+	})
+}
+
+// targetHandler serves the latest results of a target at /api/v1/targets/{target}
+func targetHandler(store *resultStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := normalizeTarget(r.PathValue("target"))
+		results := store.filter(func(result CheckStatus) bool { return result.Target == target })
+		if len(results) == 0 {
+			writeJSON(w, http.StatusNotFound, apiError{Error: "unknown target " + target})
+			return
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Target  string        `json:"target"`
+			Summary StatusSummary `json:"summary"`
+			Results []CheckStatus `json:"results"`
+		}{target, summarize(results), results})
+	})
+}
+
+// normalizeTarget returns the form targets are stored in, lowercase domains
+// without trailing dot and canonical, unmapped IP addresses
+func normalizeTarget(value string) string {
+	target := strings.TrimSuffix(strings.ToLower(value), ".")
+	if addr, err := netip.ParseAddr(target); err == nil {
+		target = addr.Unmap().String()
+	}
+	return target
+}
+
+// listHandler serves the latest results of a blacklist at /api/v1/lists/{zone}
+func listHandler(store *resultStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zone := strings.TrimSuffix(strings.ToLower(r.PathValue("zone")), ".")
+
+		results := store.filter(func(result CheckStatus) bool { return result.List == zone })
+		if len(results) == 0 {
+			writeJSON(w, http.StatusNotFound, apiError{Error: "unknown list " + zone})
+			return
+		}
+		writeJSON(w, http.StatusOK, struct {
+			List    string        `json:"list"`
+			Summary StatusSummary `json:"summary"`
+			Results []CheckStatus `json:"results"`
+		}{zone, summarize(results), results})
+	})
+}
+
+// apiError is the body of failed API requests
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode API response: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestResultStore() *resultStore {
+	store := newResultStore()
+	checked := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	zen := List{Zone: "zen.spamhaus.org"}
+	spamcop := List{Zone: "bl.spamcop.net"}
+
+	store.set(checkJob{Target: Target{IP: "192.0.2.1", Module: "mail"}, List: zen}, checkResult{
+		Result:   "Found",
+		Answers:  []string{"127.0.0.2", "127.0.0.10"},
+		Sublists: []string{"pbl", "sbl"},
+		Reason:   "https://check.spamhaus.org/",
+		Duration: 25 * time.Millisecond,
+	}, checked)
+	store.set(checkJob{Target: Target{IP: "192.0.2.1", Module: "mail"}, List: spamcop}, checkResult{Result: "NXDOMAIN"}, checked)
+	store.set(checkJob{Target: Target{IP: "2001:db8::1"}, List: zen}, checkResult{Result: "Timeout"}, checked)
+	return store
+}
+
+func TestResultStore(t *testing.T) {
+	store := newTestResultStore()
+
+	results := store.all()
+	if len(results) != 3 {
+		t.Fatalf("all() returned %d results; want %d", len(results), 3)
+	}
+	if results[0].List != "bl.spamcop.net" || results[1].List != "zen.spamhaus.org" || results[2].Target != "2001:db8::1" {
+		t.Errorf("all() not ordered by target and list: %+v", results)
+	}
+
+	listed := results[1]
+	if !listed.Listed || listed.Module != "mail" || listed.Latency != 0.025 || len(listed.Answers) != 2 || listed.Reason == "" {
+		t.Errorf("all()[1] = %+v", listed)
+	}
+
+	store.delete("zen.spamhaus.org", "192.0.2.1")
+	if got := len(store.all()); got != 2 {
+		t.Errorf("all() after delete returned %d results; want %d", got, 2)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summary := summarize(newTestResultStore().all())
+	expected := StatusSummary{Targets: 2, Lists: 2, Checks: 3, Listed: 1, Errors: 1}
+	if summary != expected {
+		t.Errorf("summarize() = %+v; want %+v", summary, expected)
+	}
+}
+
+func TestResultHandlers(t *testing.T) {
+	store := newTestResultStore()
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/status", statusHandler(store))
+	mux.Handle("GET /api/v1/targets/{target}", targetHandler(store))
+	mux.Handle("GET /api/v1/lists/{zone}", listHandler(store))
+
+	tests := []struct {
+		name    string
+		path    string
+		status  int
+		results int
+	}{
+		{name: "status", path: "/api/v1/status", status: http.StatusOK, results: 3},
+		{name: "target", path: "/api/v1/targets/192.0.2.1", status: http.StatusOK, results: 2},
+		{name: "IPv6 target", path: "/api/v1/targets/2001:DB8:0::1", status: http.StatusOK, results: 1},
+		{name: "IPv4-mapped target", path: "/api/v1/targets/::ffff:192.0.2.1", status: http.StatusOK, results: 2},
+		{name: "unknown target", path: "/api/v1/targets/192.0.2.2", status: http.StatusNotFound},
+		{name: "list", path: "/api/v1/lists/Zen.Spamhaus.org.", status: http.StatusOK, results: 2},
+		{name: "unknown list", path: "/api/v1/lists/bl.example.org", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("GET %s status = %d; want %d", tt.path, rec.Code, tt.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q; want %q", ct, "application/json")
+			}
+
+			var body struct {
+				Summary StatusSummary `json:"summary"`
+				Results []CheckStatus `json:"results"`
+				Error   string        `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if tt.status != http.StatusOK {
+				if body.Error == "" {
+					t.Errorf("GET %s returned no error message", tt.path)
+				}
+				return
+			}
+			if len(body.Results) != tt.results || body.Summary.Checks != tt.results {
+				t.Errorf("GET %s returned %d results, summary %+v; want %d", tt.path, len(body.Results), body.Summary, tt.results)
+			}
+		})
+	}
+}
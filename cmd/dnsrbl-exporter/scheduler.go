@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// scheduleEntry tracks when a check of a target against a list is due
+type scheduleEntry struct {
+	job     checkJob
+	due     time.Time
+	running bool
+}
+
+// scheduler tracks the next check of each (list, target) pair. Every list is
+// checked in its own interval, randomly shifted by up to jitter percent so that
+// checks spread out over time.
+type scheduler struct {
+	mu              sync.Mutex
+	entries         map[string]*scheduleEntry
+	defaultInterval time.Duration
+	jitter          int
+}
+
+func newScheduler(defaultInterval time.Duration, jitter int) *scheduler {
+	return &scheduler{
+		entries:         make(map[string]*scheduleEntry),
+		defaultInterval: defaultInterval,
+		jitter:          jitter,
+	}
+}
+
+// configure changes the default interval and jitter of future checks
+func (s *scheduler) configure(defaultInterval time.Duration, jitter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.defaultInterval = defaultInterval
+	s.jitter = jitter
+}
+
+func scheduleKey(job checkJob) string {
+	return job.List.Zone + "|" + job.Target.String()
+}
+
+// update replaces the scheduled pairs by the given pairs. New pairs are due
+// right away, pairs no longer configured are removed and returned.
+func (s *scheduler) update(jobs []checkJob, now time.Time) []checkJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := make(map[string]bool)
+	for _, job := range jobs {
+		key := scheduleKey(job)
+		current[key] = true
+		if entry, ok := s.entries[key]; ok {
+			entry.job = job
+		} else {
+			s.entries[key] = &scheduleEntry{job: job, due: now}
+		}
+	}
+
+	var removed []checkJob
+	for key, entry := range s.entries {
+		if !current[key] {
+			removed = append(removed, entry.job)
+			delete(s.entries, key)
+		}
+	}
+	return removed
+}
+
+// due returns all pairs due at the given time and marks them as running
+func (s *scheduler) due(now time.Time) []checkJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []*scheduleEntry
+	for _, entry := range s.entries {
+		if !entry.running && !entry.due.After(now) {
+			entries = append(entries, entry)
+		}
+	}
+
+	// Check the longest overdue pairs first, interleaving lists of a target
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].due.Equal(entries[j].due) {
+			return entries[i].due.Before(entries[j].due)
+		}
+		if entries[i].job.Target.String() != entries[j].job.Target.String() {
+			return entries[i].job.Target.String() < entries[j].job.Target.String()
+		}
+		return entries[i].job.List.Zone < entries[j].job.List.Zone
+	})
+
+	jobs := make([]checkJob, 0, len(entries))
+	for _, entry := range entries {
+		entry.running = true
+		jobs = append(jobs, entry.job)
+	}
+	return jobs
+}
+
+// done reschedules a pair after its check and returns the next due time
+func (s *scheduler) done(job checkJob, now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[scheduleKey(job)]
+	if !ok {
+		return time.Time{}
+	}
+
+	entry.running = false
+	entry.due = now.Add(s.interval(entry.job.List))
+	return entry.due
+}
+
+// release marks a pair that was not checked, e.g. of canceled checks, as not
+// running. It stays due.
+func (s *scheduler) release(job checkJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[scheduleKey(job)]; ok {
+		entry.running = false
+	}
+}
+
+// interval returns the check interval of a list including a random jitter
+func (s *scheduler) interval(list List) time.Duration {
+	interval := list.Interval
+	if interval <= 0 {
+		interval = s.defaultInterval
+	}
+	if s.jitter <= 0 {
+		return interval
+	}
+
+	jitter := float64(interval) * float64(s.jitter) / 100
+	return interval + time.Duration((rand.Float64()*2-1)*jitter)
+}
+
+// next returns the earliest due time of all pairs not running, or the zero
+// time if there are none
+func (s *scheduler) next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, entry := range s.entries {
+		if !entry.running && (next.IsZero() || entry.due.Before(next)) {
+			next = entry.due
+		}
+	}
+	return next
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	now := time.Now()
+	sched := newScheduler(time.Minute, 0)
+
+	targets := []Target{{IP: "192.0.2.1"}, {Domain: "example.com"}}
+	lists := []List{
+		{Zone: "bl.example.org", Type: listTypeIP, IPv4: true},
+		{Zone: "slow.example.org", Type: listTypeIP, IPv4: true, Interval: time.Hour},
+		{Zone: "dbl.example.org", Type: listTypeDomain},
+	}
+
+	if removed := sched.update(checkJobs(targets, lists, nil), now); len(removed) != 0 {
+		t.Errorf("update() removed %d pairs; want %d", len(removed), 0)
+	}
+
+	// All supported pairs are due right away
+	jobs := sched.due(now)
+	if len(jobs) != 3 {
+		t.Fatalf("due() returned %d jobs; want %d", len(jobs), 3)
+	}
+
+	// Running pairs are not due again
+	if jobs := sched.due(now); len(jobs) != 0 {
+		t.Errorf("due() returned %d running jobs; want %d", len(jobs), 0)
+	}
+	if next := sched.next(); !next.IsZero() {
+		t.Errorf("next() = %v with all pairs running; want zero time", next)
+	}
+
+	for _, job := range jobs {
+		sched.done(job, now)
+	}
+
+	if next := sched.next(); !next.Equal(now.Add(time.Minute)) {
+		t.Errorf("next() = %v; want %v", next, now.Add(time.Minute))
+	}
+
+	// Only lists with the default interval are due after a minute
+	jobs = sched.due(now.Add(time.Minute))
+	if len(jobs) != 2 {
+		t.Fatalf("due() after a minute returned %d jobs; want %d", len(jobs), 2)
+	}
+	for _, job := range jobs {
+		if job.List.Zone == "slow.example.org" {
+			t.Error("list with hourly interval is due after a minute")
+		}
+		sched.done(job, now.Add(time.Minute))
+	}
+
+	if jobs := sched.due(now.Add(time.Hour)); len(jobs) != 3 {
+		t.Errorf("due() after an hour returned %d jobs; want %d", len(jobs), 3)
+	}
+}
+
+func TestScheduler_UpdateRemovesPairs(t *testing.T) {
+	now := time.Now()
+	sched := newScheduler(time.Minute, 0)
+	lists := []List{{Zone: "bl.example.org", Type: listTypeIP, IPv4: true}}
+
+	sched.update(checkJobs([]Target{{IP: "192.0.2.1"}, {IP: "192.0.2.2"}}, lists, nil), now)
+	removed := sched.update(checkJobs([]Target{{IP: "192.0.2.2"}}, lists, nil), now)
+
+	if len(removed) != 1 || removed[0].Target.IP != "192.0.2.1" {
+		t.Errorf("update() removed %+v; want pair of 192.0.2.1", removed)
+	}
+	if jobs := sched.due(now); len(jobs) != 1 {
+		t.Errorf("due() returned %d jobs; want %d", len(jobs), 1)
+	}
+}
+
+func TestScheduler_Jitter(t *testing.T) {
+	sched := newScheduler(time.Minute, 10)
+	list := List{Zone: "bl.example.org", Interval: 100 * time.Second}
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		interval := sched.interval(list)
+		if interval < 90*time.Second || interval > 110*time.Second {
+			t.Fatalf("interval() = %v; want within 10%% of %v", interval, 100*time.Second)
+		}
+		seen[interval] = true
+	}
+	if len(seen) < 2 {
+		t.Error("interval() returned the same interval every time; want jitter")
+	}
+}
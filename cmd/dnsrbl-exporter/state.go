@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the state file
+var (
+	resultsBucket  = []byte("results")  // latest check result per list and target
+	listingsBucket = []byte("listings") // start of the current listing per list and target
+	eventsBucket   = []byte("events")   // listing events by sequence number
+)
+
+// stateStore persists the latest check results in a local BoltDB file, so that
+// the last known state is available right after a restart
+type stateStore struct {
+	db *bolt.DB
+}
+
+// openStateStore opens or creates a state file
+func openStateStore(filename string) (*stateStore, error) {
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file %s: %w", filename, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{resultsBucket, listingsBucket, eventsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize state file %s: %w", filename, err)
+	}
+	return &stateStore{db: db}, nil
+}
+
+// close closes the state file
+func (s *stateStore) close() error {
+	return s.db.Close()
+}
+
+// save stores the result of a check, batching concurrent writes
+func (s *stateStore) save(status CheckStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).Put([]byte(reasonKey(status.List, status.Target)), value)
+	})
+}
+
+// delete removes the result of a blacklist and target
+func (s *stateStore) delete(blacklist, target string) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).Delete([]byte(reasonKey(blacklist, target)))
+	})
+}
+
+// load returns all stored results. Unreadable entries are skipped.
+func (s *stateStore) load() ([]CheckStatus, error) {
+	var results []CheckStatus
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).ForEach(func(key, value []byte) error {
+			var status CheckStatus
+			if err := json.Unmarshal(value, &status); err != nil {
+				log.Printf("Skipping unreadable state of %s: %v", key, err)
+				return nil
+			}
+			results = append(results, status)
+			return nil
+		})
+	})
+	return results, err
+}
+
+// saveEvent appends a listing event, keeping the latest limit events, and
+// updates the start of the listing
+func (s *stateStore) saveEvent(event ListingEvent, limit int) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		key := []byte(reasonKey(event.List, event.Target))
+		listings := tx.Bucket(listingsBucket)
+		if event.Type == eventListed {
+			since, err := event.Time.MarshalText()
+			if err != nil {
+				return err
+			}
+			if err := listings.Put(key, since); err != nil {
+				return err
+			}
+		} else if err := listings.Delete(key); err != nil {
+			return err
+		}
+
+		events := tx.Bucket(eventsBucket)
+		seq, err := events.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := events.Put(sequenceKey(seq), value); err != nil {
+			return err
+		}
+
+		// Drop the oldest events
+		if seq <= uint64(limit) {
+			return nil
+		}
+		oldest := string(sequenceKey(seq - uint64(limit)))
+		var dropped [][]byte
+		cursor := events.Cursor()
+		for key, _ := cursor.First(); key != nil && string(key) <= oldest; key, _ = cursor.Next() {
+			dropped = append(dropped, append([]byte(nil), key...))
+		}
+		for _, key := range dropped {
+			if err := events.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteListing removes the start of the listing of a blacklist and target
+func (s *stateStore) deleteListing(blacklist, target string) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(listingsBucket).Delete([]byte(reasonKey(blacklist, target)))
+	})
+}
+
+// loadEvents returns all stored listing events, oldest first, and the start of
+// the current listings by list and target. Unreadable entries are skipped.
+func (s *stateStore) loadEvents() ([]ListingEvent, map[string]time.Time, error) {
+	var events []ListingEvent
+	listings := make(map[string]time.Time)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(eventsBucket).ForEach(func(key, value []byte) error {
+			var event ListingEvent
+			if err := json.Unmarshal(value, &event); err != nil {
+				log.Printf("Skipping unreadable event %x: %v", key, err)
+				return nil
+			}
+			events = append(events, event)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(listingsBucket).ForEach(func(key, value []byte) error {
+			var since time.Time
+			if err := since.UnmarshalText(value); err != nil {
+				log.Printf("Skipping unreadable listing of %s: %v", key, err)
+				return nil
+			}
+			listings[string(key)] = since
+			return nil
+		})
+	})
+	return events, listings, err
+}
+
+// sequenceKey encodes a sequence number as key sorting in numerical order
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// restoreState restores the stored results of the given pairs into the result
+// store and the metrics. Stored results of other pairs are dropped.
+func restoreState(state *stateStore, jobs []checkJob, results *resultStore, cidrs *cidrTracker) error {
+	stored, err := state.load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	byKey := make(map[string]CheckStatus, len(stored))
+	for _, status := range stored {
+		byKey[reasonKey(status.List, status.Target)] = status
+	}
+
+	restored := 0
+	for _, job := range jobs {
+		key := reasonKey(job.List.Zone, job.Target.String())
+		status, ok := byKey[key]
+		if !ok {
+			continue
+		}
+		delete(byKey, key)
+
+		result := checkResult{
+			Result:   status.Result,
+			Answers:  status.Answers,
+			Sublists: status.Sublists,
+			Reason:   status.Reason,
+			Duration: time.Duration(status.Latency * float64(time.Second)),
+		}
+
+		// Query counters only count queries of this run
+		metrics := ipResultMetrics
+		if job.Target.Domain != "" {
+			metrics = domainResultMetrics
+		}
+		metrics.query = nil
+		metrics.record(job.List.Zone, job.Target.String(), result)
+		cidrs.update(job.Target, job.List.Zone, status.Listed)
+		dnsrblLastCheck.With(pairLabels(job.List.Zone, job.Target.String())).Set(float64(status.Checked.Unix()))
+		results.restore(status)
+		restored++
+	}
+
+	for _, status := range byKey {
+		if err := state.delete(status.List, status.Target); err != nil {
+			log.Printf("Failed to delete state of %s on %s: %v", status.Target, status.List, err)
+		}
+	}
+
+	log.Printf("Restored %d results from state file, dropped %d", restored, len(byKey))
+	return nil
+}
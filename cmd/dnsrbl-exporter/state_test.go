@@ -0,0 +1,137 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func openTestStateStore(t *testing.T) (*stateStore, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "state.db")
+	state, err := openStateStore(filename)
+	if err != nil {
+		t.Fatalf("openStateStore() error = %v", err)
+	}
+	t.Cleanup(func() { state.close() })
+	return state, filename
+}
+
+func TestStateStore(t *testing.T) {
+	state, filename := openTestStateStore(t)
+
+	// Deletions are written through the result store
+	store := newTestResultStore()
+	store.persist(state)
+	for _, result := range store.all() {
+		if err := state.save(result); err != nil {
+			t.Fatalf("save() error = %v", err)
+		}
+	}
+	store.delete("bl.spamcop.net", "192.0.2.1")
+
+	// Reopen the file as after a restart
+	if err := state.close(); err != nil {
+		t.Fatalf("close() error = %v", err)
+	}
+	state, err := openStateStore(filename)
+	if err != nil {
+		t.Fatalf("openStateStore() error = %v", err)
+	}
+	defer state.close()
+
+	stored, err := state.load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("load() returned %d results; want %d", len(stored), 2)
+	}
+	for _, status := range stored {
+		if status.List == "zen.spamhaus.org" && status.Target == "192.0.2.1" {
+			if !status.Listed || status.Module != "mail" || status.Reason != "https://check.spamhaus.org/" || len(status.Sublists) != 2 {
+				t.Errorf("stored status = %+v", status)
+			}
+			if !status.Checked.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+				t.Errorf("Checked = %v", status.Checked)
+			}
+		}
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	state, _ := openTestStateStore(t)
+
+	vecs := []*prometheus.GaugeVec{dnsrblStatus, dnsrblListed, dnsrblListingReason, dnsrblDomainStatus, dnsrblLastCheck, dnsrblCIDRListed}
+	reset := func() {
+		for _, vec := range vecs {
+			vec.Reset()
+		}
+		dnsrblQuery.Reset()
+		listingReasons.reasons = make(map[string]ListingReason)
+	}
+	reset()
+	defer reset()
+
+	target := Target{IP: "198.51.100.1", CIDR: "198.51.100.0/30"}
+	domain := Target{Domain: "example.com"}
+	zen := List{Zone: "zen.spamhaus.org", Type: listTypeIP, IPv4: true}
+	dbl := List{Zone: "dbl.spamhaus.org", Type: listTypeDomain}
+	checked := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	stored := newResultStore()
+	stored.persist(state)
+	stored.set(checkJob{Target: target, List: zen}, checkResult{Result: "Found", Sublists: []string{"sbl"}, Reason: "spam"}, checked)
+	stored.set(checkJob{Target: domain, List: dbl}, checkResult{Result: "NXDOMAIN"}, checked)
+	stored.set(checkJob{Target: Target{IP: "192.0.2.1"}, List: zen}, checkResult{Result: "Found"}, checked)
+
+	// 192.0.2.1 is no longer configured
+	results := newResultStore()
+	cidrs := newCIDRTracker()
+	jobs := []checkJob{{Target: target, List: zen}, {Target: domain, List: dbl}}
+	if err := restoreState(state, jobs, results, cidrs); err != nil {
+		t.Fatalf("restoreState() error = %v", err)
+	}
+
+	restored := results.all()
+	if len(restored) != 2 {
+		t.Fatalf("restored %d results; want %d", len(restored), 2)
+	}
+	for _, status := range restored {
+		if !status.Restored {
+			t.Errorf("%s on %s not marked as restored", status.Target, status.List)
+		}
+	}
+
+	if got := testutil.ToFloat64(dnsrblStatus.WithLabelValues(zen.Zone, target.IP)); got != 1 {
+		t.Errorf("dnsrbl_status = %v; want 1", got)
+	}
+	if got := testutil.ToFloat64(dnsrblListed.WithLabelValues(zen.Zone, target.IP, "sbl")); got != 1 {
+		t.Errorf("dnsrbl_listed = %v; want 1", got)
+	}
+	if got := testutil.ToFloat64(dnsrblDomainStatus.WithLabelValues(dbl.Zone, domain.Domain)); got != 0 {
+		t.Errorf("dnsrbl_domain_status = %v; want 0", got)
+	}
+	if got := testutil.ToFloat64(dnsrblLastCheck.WithLabelValues(zen.Zone, target.IP, "")); got != float64(checked.Unix()) {
+		t.Errorf("dnsrbl_last_check_timestamp_seconds = %v; want %v", got, checked.Unix())
+	}
+	if got := testutil.ToFloat64(dnsrblCIDRListed.WithLabelValues(zen.Zone, target.CIDR)); got != 1 {
+		t.Errorf("dnsrbl_cidr_listed = %v; want 1", got)
+	}
+	// Restored results are not counted as queries
+	if got := testutil.CollectAndCount(dnsrblQuery); got != 0 {
+		t.Errorf("dnsrbl_query series = %d; want 0", got)
+	}
+
+	// The result of the removed target is dropped from the file
+	remaining, err := state.load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if len(remaining) != 2 {
+		t.Errorf("state holds %d results; want %d", len(remaining), 2)
+	}
+}
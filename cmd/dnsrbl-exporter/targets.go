@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Target is a single address or domain to be checked against the configured blacklists
+type Target struct {
+	IP     string
+	CIDR   string // Range the address was expanded from, empty for single addresses
+	Domain string
+	Module string // Module selecting the lists of the target, all lists if empty
+}
+
+// String returns the checked address or domain
+func (t Target) String() string {
+	if t.Domain != "" {
+		return t.Domain
+	}
+	return t.IP
+}
+
+// targetSet collects unique targets, each assigned to a single module
+type targetSet struct {
+	targets []Target
+	modules map[string]string
+}
+
+// add adds a target unless it was added before
+func (s *targetSet) add(target Target) error {
+	if s.modules == nil {
+		s.modules = make(map[string]string)
+	}
+
+	if module, ok := s.modules[target.String()]; ok {
+		if module != target.Module {
+			return fmt.Errorf("check target %s is assigned to modules %q and %q", target, module, target.Module)
+		}
+		return nil
+	}
+	s.modules[target.String()] = target.Module
+	s.targets = append(s.targets, target)
+	return nil
+}
+
+// expandTargets turns a list of IP addresses and CIDR ranges into individual targets.
+// Entries may select a module with an "@module" suffix. Ranges holding more than
+// maxCIDRSize addresses are rejected. IPv4-mapped IPv6 addresses are checked as
+// IPv4 addresses.
+func expandTargets(entries []string, maxCIDRSize int) ([]Target, error) {
+	var targets targetSet
+
+	for _, entry := range entries {
+		entry, module, _ := strings.Cut(entry, "@")
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid check IP %q: %w", entry, err)
+			}
+			if err := targets.add(Target{IP: addr.Unmap().String(), Module: module}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid check CIDR %q: %w", entry, err)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefix = prefix.Masked()
+
+		hostBits := prefix.Addr().BitLen() - prefix.Bits()
+		if hostBits >= 63 || 1<<hostBits > maxCIDRSize {
+			return nil, fmt.Errorf("check CIDR %s exceeds the maximum size of %d addresses", prefix, maxCIDRSize)
+		}
+
+		for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+			if err := targets.add(Target{IP: addr.String(), CIDR: prefix.String(), Module: module}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return targets.targets, nil
+}
+
+// domainTargets turns a list of domain names into targets. Entries may select
+// a module with an "@module" suffix.
+func domainTargets(entries []string) ([]Target, error) {
+	var targets targetSet
+
+	for _, entry := range entries {
+		name, module, _ := strings.Cut(entry, "@")
+		domain := strings.TrimSuffix(strings.ToLower(name), ".")
+		if domain == "" || strings.ContainsAny(domain, "/:@ ") || net.ParseIP(domain) != nil {
+			return nil, fmt.Errorf("invalid check domain %q", entry)
+		}
+		if err := targets.add(Target{Domain: domain, Module: module}); err != nil {
+			return nil, err
+		}
+	}
+
+	return targets.targets, nil
+}
+
+// cidrTracker keeps track of listed addresses per CIDR range and blacklist
+// to expose an aggregate count for each range.
+type cidrTracker struct {
+	mu     sync.Mutex
+	listed map[string]map[string]map[string]bool // cidr -> list -> ip
+}
+
+func newCIDRTracker() *cidrTracker {
+	return &cidrTracker{listed: make(map[string]map[string]map[string]bool)}
+}
+
+// update records the listing state of an address and refreshes the aggregate metric
+func (c *cidrTracker) update(target Target, blacklist string, listed bool) {
+	if target.CIDR == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lists, ok := c.listed[target.CIDR]
+	if !ok {
+		lists = make(map[string]map[string]bool)
+		c.listed[target.CIDR] = lists
+	}
+	ips, ok := lists[blacklist]
+	if !ok {
+		ips = make(map[string]bool)
+		lists[blacklist] = ips
+	}
+
+	if listed {
+		ips[target.IP] = true
+	} else {
+		delete(ips, target.IP)
+	}
+
+	dnsrblCIDRListed.WithLabelValues(blacklist, target.CIDR).Set(float64(len(ips)))
+}
+
+// count returns the number of listed addresses of a CIDR range on a blacklist
+func (c *cidrTracker) count(cidr, blacklist string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.listed[cidr][blacklist])
+}
+
+// remove forgets a CIDR range and deletes its metrics
+func (c *cidrTracker) remove(cidr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.listed, cidr)
+	dnsrblCIDRListed.DeletePartialMatch(prometheus.Labels{"cidr": cidr})
+	dnsrblCIDRSize.DeleteLabelValues(cidr)
+}
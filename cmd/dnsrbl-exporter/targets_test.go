@@ -0,0 +1,178 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExpandTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []string
+		maxSize     int
+		expected    []Target
+		shouldError bool
+	}{
+		{
+			name:     "single IPs",
+			entries:  []string{"192.168.1.1", "10.0.0.1"},
+			maxSize:  256,
+			expected: []Target{{IP: "192.168.1.1"}, {IP: "10.0.0.1"}},
+		},
+		{
+			name:    "small CIDR",
+			entries: []string{"203.0.113.0/30"},
+			maxSize: 256,
+			expected: []Target{
+				{IP: "203.0.113.0", CIDR: "203.0.113.0/30"},
+				{IP: "203.0.113.1", CIDR: "203.0.113.0/30"},
+				{IP: "203.0.113.2", CIDR: "203.0.113.0/30"},
+				{IP: "203.0.113.3", CIDR: "203.0.113.0/30"},
+			},
+		},
+		{
+			name:     "unmasked CIDR is normalized",
+			entries:  []string{"203.0.113.5/31"},
+			maxSize:  256,
+			expected: []Target{{IP: "203.0.113.4", CIDR: "203.0.113.4/31"}, {IP: "203.0.113.5", CIDR: "203.0.113.4/31"}},
+		},
+		{
+			name:     "duplicates are removed",
+			entries:  []string{"203.0.113.1", "203.0.113.0/31"},
+			maxSize:  256,
+			expected: []Target{{IP: "203.0.113.1"}, {IP: "203.0.113.0", CIDR: "203.0.113.0/31"}},
+		},
+		{
+			name:     "IPv4-mapped addresses are unmapped",
+			entries:  []string{"127.0.0.2", "::ffff:127.0.0.2", "::ffff:203.0.113.0/127"},
+			maxSize:  256,
+			expected: []Target{{IP: "127.0.0.2"}, {IP: "203.0.113.0", CIDR: "203.0.113.0/31"}, {IP: "203.0.113.1", CIDR: "203.0.113.0/31"}},
+		},
+		{
+			name:    "modules",
+			entries: []string{"192.168.1.1@web", "203.0.113.0/31@mail", "192.168.1.1@web"},
+			maxSize: 256,
+			expected: []Target{
+				{IP: "192.168.1.1", Module: "web"},
+				{IP: "203.0.113.0", CIDR: "203.0.113.0/31", Module: "mail"},
+				{IP: "203.0.113.1", CIDR: "203.0.113.0/31", Module: "mail"},
+			},
+		},
+		{
+			name:        "conflicting modules",
+			entries:     []string{"203.0.113.0/31@mail", "203.0.113.1@web"},
+			maxSize:     256,
+			shouldError: true,
+		},
+		{
+			name:        "CIDR exceeds maximum size",
+			entries:     []string{"203.0.113.0/24"},
+			maxSize:     64,
+			shouldError: true,
+		},
+		{
+			name:        "invalid IP",
+			entries:     []string{"not-an-ip"},
+			maxSize:     256,
+			shouldError: true,
+		},
+		{
+			name:        "invalid CIDR",
+			entries:     []string{"203.0.113.0/33"},
+			maxSize:     256,
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := expandTargets(tt.entries, tt.maxSize)
+			if tt.shouldError {
+				if err == nil {
+					t.Errorf("expandTargets(%q) expected error but got none", tt.entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandTargets(%q) unexpected error: %v", tt.entries, err)
+			}
+
+			if len(result) != len(tt.expected) {
+				t.Fatalf("expandTargets(%q) returned %d targets; want %d", tt.entries, len(result), len(tt.expected))
+			}
+			for i := range result {
+				if result[i] != tt.expected[i] {
+					t.Errorf("expandTargets(%q)[%d] = %+v; want %+v", tt.entries, i, result[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDomainTargets(t *testing.T) {
+	targets, err := domainTargets([]string{"Example.com.", "mail.example.org", "example.com"})
+	if err != nil {
+		t.Fatalf("domainTargets() unexpected error: %v", err)
+	}
+
+	expected := []Target{{Domain: "example.com"}, {Domain: "mail.example.org"}}
+	if len(targets) != len(expected) {
+		t.Fatalf("domainTargets() returned %d targets; want %d", len(targets), len(expected))
+	}
+	for i := range targets {
+		if targets[i] != expected[i] {
+			t.Errorf("domainTargets()[%d] = %+v; want %+v", i, targets[i], expected[i])
+		}
+	}
+
+	targets, err = domainTargets([]string{"example.com@web"})
+	if err != nil || len(targets) != 1 || targets[0] != (Target{Domain: "example.com", Module: "web"}) {
+		t.Errorf("domainTargets(example.com@web) = %+v, %v", targets, err)
+	}
+
+	for _, invalid := range []string{"192.0.2.1", "example.com/path", "", "@web"} {
+		if _, err := domainTargets([]string{invalid}); err == nil {
+			t.Errorf("domainTargets(%q) expected error but got none", invalid)
+		}
+	}
+	if _, err := domainTargets([]string{"example.com@web", "Example.com@mail"}); err == nil {
+		t.Error("domainTargets() expected error for conflicting modules but got none")
+	}
+}
+
+func TestTargetString(t *testing.T) {
+	if got := (Target{IP: "192.0.2.1", CIDR: "192.0.2.0/30"}).String(); got != "192.0.2.1" {
+		t.Errorf("String() = %q; want %q", got, "192.0.2.1")
+	}
+	if got := (Target{Domain: "example.com"}).String(); got != "example.com" {
+		t.Errorf("String() = %q; want %q", got, "example.com")
+	}
+}
+
+func TestCIDRTracker(t *testing.T) {
+	tracker := newCIDRTracker()
+	cidr := "203.0.113.0/30"
+
+	tracker.update(Target{IP: "203.0.113.1", CIDR: cidr}, "zen.spamhaus.org", true)
+	tracker.update(Target{IP: "203.0.113.2", CIDR: cidr}, "zen.spamhaus.org", true)
+	tracker.update(Target{IP: "203.0.113.2", CIDR: cidr}, "bl.spamcop.net", true)
+	tracker.update(Target{IP: "203.0.113.3", CIDR: cidr}, "zen.spamhaus.org", false)
+
+	if got := tracker.count(cidr, "zen.spamhaus.org"); got != 2 {
+		t.Errorf("count(zen.spamhaus.org) = %d; want %d", got, 2)
+	}
+	if got := tracker.count(cidr, "bl.spamcop.net"); got != 1 {
+		t.Errorf("count(bl.spamcop.net) = %d; want %d", got, 1)
+	}
+
+	// Delisting removes the address from the aggregate
+	tracker.update(Target{IP: "203.0.113.1", CIDR: cidr}, "zen.spamhaus.org", false)
+	if got := tracker.count(cidr, "zen.spamhaus.org"); got != 1 {
+		t.Errorf("count(zen.spamhaus.org) after delisting = %d; want %d", got, 1)
+	}
+
+	// Single addresses are not tracked
+	tracker.update(Target{IP: "192.168.1.1"}, "zen.spamhaus.org", true)
+	if got := tracker.count("", "zen.spamhaus.org"); got != 0 {
+		t.Errorf("count() for single address = %d; want %d", got, 0)
+	}
+}
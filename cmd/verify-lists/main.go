@@ -29,6 +29,9 @@ func main() {
 			continue
 		}
 
+		// Strip list options such as "zen.spamhaus.org:ipv4,ipv6"
+		line, _, _ = strings.Cut(line, ":")
+
 		total++
 		fmt.Printf("Testing %s... ", line)
 